@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+
+	"github.com/normen/whatscli/config"
+	"github.com/normen/whatscli/messages"
+	"github.com/rivo/tview"
+)
+
+// the name of the account shown in the UI, read by the handlers of all accounts
+var activeAccount atomic.Value
+
+// the session managers of all accounts used since the start, by name
+var sessionManagers = make(map[string]*messages.SessionManager)
+
+// the last known state of an account, only used on the UI thread
+type accountState struct {
+	status messages.SessionStatus
+	unread int
+}
+
+var accountStates = make(map[string]accountState)
+
+// switches the UI to another account, starting its session if needed. Unless
+// parallel accounts are enabled the previous account is disconnected.
+func SwitchAccount(name string) {
+	if name == config.GetAccount() {
+		PrintText("Already using account " + name)
+		return
+	}
+	previous := sessionManager
+	if typingChat != "" {
+		previous.CommandChannel <- messages.Command{"typing", []string{typingChat, "paused"}}
+		typingChat = ""
+	}
+	// the previous account keeps running with parallel accounts, without a
+	// selected chat all its new messages count as unread
+	previous.CommandChannel <- messages.Command{"select", []string{""}}
+	if err := config.SetAccount(name); err != nil {
+		PrintError(err)
+		return
+	}
+	sm, started := sessionManagers[name]
+	if !started {
+		sm = &messages.SessionManager{Account: name}
+		sm.Init(UiHandler{account: name})
+		sessionManagers[name] = sm
+	}
+	activeAccount.Store(name)
+	sessionManager = sm
+	uiHandler = UiHandler{account: name}
+	currentReceiver = messages.Chat{}
+	textView.Clear()
+	PrintText("Switched to account [::b]" + tview.Escape(name) + "[::-]")
+	uiHandler.SetChats(sm.GetChats())
+	UpdateStatusBar(accountStates[name].status)
+	UpdateTopBar("")
+	if !config.Config.General.ParallelAccounts {
+		previous.CommandChannel <- messages.Command{"disconnect", nil}
+	}
+	if !started {
+		if err := sm.StartManager(); err != nil {
+			PrintError(err)
+		}
+		return
+	}
+	sm.CommandChannel <- messages.Command{"select", []string{""}}
+	if !accountStates[name].status.Connected {
+		sm.CommandChannel <- messages.Command{"connect", nil}
+	}
+}
+
+// prints the known accounts with their connection state and unread messages
+func PrintAccounts() {
+	names := config.GetAccounts()
+	for name := range sessionManagers {
+		known := false
+		for _, other := range names {
+			known = known || other == name
+		}
+		if !known {
+			names = append(names, name)
+		}
+	}
+	sort.SliceStable(names[1:], func(i, j int) bool {
+		return names[1+i] < names[1+j]
+	})
+	fmt.Fprintln(textView, "[-::u]Accounts:[-::-]")
+	for _, name := range names {
+		line := "  " + tview.Escape(name)
+		if name == config.GetAccount() {
+			line = "[::b]* " + tview.Escape(name) + "[::-]"
+		}
+		state, started := accountStates[name]
+		switch {
+		case state.status.Connected:
+			line += " [" + config.Config.Colors.Positive + "]online[-]"
+		case started:
+			line += " [" + config.Config.Colors.Negative + "]offline[-]"
+		default:
+			line += " [::d]not started[::-]"
+		}
+		if state.unread > 0 {
+			line += " ([" + config.Config.Colors.UnreadCount + "]" + fmt.Sprint(state.unread) + "[-])"
+		}
+		fmt.Fprintln(textView, line)
+	}
+	fmt.Fprintln(textView, "Use [::b]"+config.Config.General.CmdPrefix+"account name[::-] to switch, new names log in a new account")
+}
+
+// starts the sessions of all other known accounts in the background
+func startAccounts() {
+	for _, name := range config.GetAccounts() {
+		if _, started := sessionManagers[name]; started {
+			continue
+		}
+		sm := &messages.SessionManager{Account: name}
+		sm.Init(UiHandler{account: name})
+		sessionManagers[name] = sm
+		if err := sm.StartManager(); err != nil {
+			PrintError(err)
+		}
+	}
+}
+
+// disconnects the sessions of all accounts
+func disconnectAccounts() {
+	for _, sm := range sessionManagers {
+		sm.CommandChannel <- messages.Command{"disconnect", nil}
+	}
+}
+
+// stores the number of unread messages of an account
+func setAccountUnread(name string, chats []messages.Chat) {
+	unread := 0
+	for _, chat := range chats {
+		unread += chat.Unread
+	}
+	state := accountStates[name]
+	state.unread = unread
+	accountStates[name] = state
+}
+
+// shows the current account and the unread messages of the other accounts
+// in the status bar, if more than one account is used
+func getAccountsString() string {
+	current := config.GetAccount()
+	if len(sessionManagers) < 2 && current == config.DefaultAccount {
+		return ""
+	}
+	out := "[::b]" + tview.Escape(current) + "[::-] "
+	unread := 0
+	for name, state := range accountStates {
+		if name != current {
+			unread += state.unread
+		}
+	}
+	if unread > 0 {
+		out += "[" + config.Config.Colors.UnreadCount + "]+" + fmt.Sprint(unread) + "[-] "
+	}
+	return out
+}
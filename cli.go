@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/normen/whatscli/config"
+	"github.com/normen/whatscli/messages"
+)
+
+// exit codes of the one-shot subcommands
+const (
+	exitOk    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+const connectTimeout = 30 * time.Second
+
+// names and usage of the one-shot subcommands
+var subcommands = map[string]string{
+	"send":      "send [chat-id|number|name] text",
+	"send-file": "send-file [chat-id|number|name] /path/to/file",
+	"chats":     "chats [--json] [--offline]",
+	"messages":  "messages [chat-id|number|name] [--since 2h] [--json] [--offline]",
+	"export":    "export [chat-id|number|name] [json|markdown|html|txt] [/path/to/file] [--media]",
+	"import":    "import [chat-id|number|name] /path/to/export.zip",
+}
+
+// runs a one-shot subcommand and returns the exit code
+func RunSubcommand(args []string, stdout, stderr io.Writer) int {
+	usage, ok := subcommands[args[0]]
+	if !ok {
+		printSubcommandUsage(stderr)
+		return exitUsage
+	}
+	flags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	jsonOutput := flags.Bool("json", false, "print JSON")
+	since := flags.String("since", "", "only messages newer than this duration, e.g. 30m, 2h or 7d")
+	withMedia := flags.Bool("media", false, "download attachments next to the export")
+	offline := flags.Bool("offline", false, "only read the local store, without fetching new messages")
+	params, err := parseInterspersed(flags, args[1:])
+	if err != nil {
+		return exitUsage
+	}
+
+	sm := &messages.SessionManager{}
+	sm.Init(cliHandler{stderr})
+	switch args[0] {
+	case "send", "send-file":
+		if len(params) < 2 {
+			fmt.Fprintln(stderr, "usage: whatscli", usage)
+			return exitUsage
+		}
+		err = runSend(sm, args[0], params[0], strings.Join(params[1:], " "))
+	case "chats":
+		err = runChats(sm, stdout, *jsonOutput, *offline)
+	case "messages":
+		if len(params) != 1 {
+			fmt.Fprintln(stderr, "usage: whatscli", usage)
+			return exitUsage
+		}
+		err = runMessages(sm, stdout, params[0], *since, *jsonOutput, *offline)
+	case "export":
+		if len(params) < 2 {
+			fmt.Fprintln(stderr, "usage: whatscli", usage)
+			return exitUsage
+		}
+		err = runExport(sm, stdout, params[0], params[1], strings.Join(params[2:], " "), *withMedia)
+	case "import":
+		if len(params) < 2 {
+			fmt.Fprintln(stderr, "usage: whatscli", usage)
+			return exitUsage
+		}
+		err = runImport(sm, stdout, params[0], strings.Join(params[1:], " "))
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "error:", err)
+		return exitError
+	}
+	return exitOk
+}
+
+func printSubcommandUsage(out io.Writer) {
+	fmt.Fprintln(out, "usage: whatscli [--daemon]")
+	for _, name := range []string{"send", "send-file", "chats", "messages", "export", "import"} {
+		fmt.Fprintln(out, "       whatscli", subcommands[name])
+	}
+}
+
+// parses flags that may appear between positional arguments
+func parseInterspersed(flags *flag.FlagSet, args []string) ([]string, error) {
+	params := make([]string, 0, len(args))
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			return params, nil
+		}
+		params = append(params, args[0])
+		args = args[1:]
+	}
+}
+
+// checks that no daemon is running with the same login. WhatsApp keeps one
+// connection per device, connecting here would drop the one of the daemon.
+func checkNoDaemon(hint string) error {
+	path := config.GetSocketFilePath()
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err != nil {
+		return nil
+	}
+	conn.Close()
+	return fmt.Errorf("whatscli is running as daemon with this account and would be disconnected, %s", hint)
+}
+
+func runSend(sm *messages.SessionManager, command, chat, arg string) error {
+	if err := checkNoDaemon("send through its socket " + config.GetSocketFilePath() + " instead"); err != nil {
+		return err
+	}
+	if err := sm.Connect(connectTimeout); err != nil {
+		return err
+	}
+	defer sm.Close()
+	chatID, err := sm.FindChat(chat)
+	if err != nil {
+		return err
+	}
+	if command == "send-file" {
+		return sm.SendFile(chatID, arg)
+	}
+	return sm.SendText(chatID, arg)
+}
+
+// openForReading fetches the messages received while whatscli was not
+// running, or only opens the local store when offline
+func openForReading(sm *messages.SessionManager, offline bool) error {
+	if offline {
+		return sm.OpenStore()
+	}
+	if err := checkNoDaemon("use --offline to read the local store"); err != nil {
+		return err
+	}
+	return sm.Sync(connectTimeout)
+}
+
+func runChats(sm *messages.SessionManager, out io.Writer, jsonOutput, offline bool) error {
+	if err := openForReading(sm, offline); err != nil {
+		return err
+	}
+	defer sm.Close()
+	chats := sm.GetChats()
+	if jsonOutput {
+		return json.NewEncoder(out).Encode(chats)
+	}
+	for _, chat := range chats {
+		fmt.Fprintf(out, "%s\t%d\t%s\n", chat.Id, chat.Unread, chat.Name)
+	}
+	return nil
+}
+
+func runMessages(sm *messages.SessionManager, out io.Writer, chat, since string, jsonOutput, offline bool) error {
+	var minTime uint64
+	if since != "" {
+		duration, err := parseSince(since)
+		if err != nil {
+			return err
+		}
+		minTime = uint64(time.Now().Add(-duration).Unix())
+	}
+	if err := openForReading(sm, offline); err != nil {
+		return err
+	}
+	defer sm.Close()
+	chatID, err := sm.FindChat(chat)
+	if err != nil {
+		return err
+	}
+	msgs := make([]messages.Message, 0)
+	for _, msg := range sm.GetMessages(chatID) {
+		if msg.Timestamp >= minTime {
+			msgs = append(msgs, msg)
+		}
+	}
+	if jsonOutput {
+		return json.NewEncoder(out).Encode(msgs)
+	}
+	for _, msg := range msgs {
+		sender := msg.ContactShort
+		if msg.FromMe {
+			sender = "Me"
+		}
+		tim := time.Unix(int64(msg.Timestamp), 0).Format("02-01-06 15:04:05")
+		fmt.Fprintf(out, "(%s) %s: %s\n", tim, sender, msg.Text)
+	}
+	return nil
+}
+
+func runExport(sm *messages.SessionManager, out io.Writer, chat, format, path string, withMedia bool) error {
+	var err error
+	if withMedia {
+		err = sm.Connect(connectTimeout)
+	} else {
+		err = sm.OpenStore()
+	}
+	if err != nil {
+		return err
+	}
+	defer sm.Close()
+	chatID, err := sm.FindChat(chat)
+	if err != nil {
+		return err
+	}
+	if path, err = sm.ExportChat(chatID, format, path, withMedia); err != nil {
+		return err
+	}
+	fmt.Fprintln(out, path)
+	return nil
+}
+
+func runImport(sm *messages.SessionManager, out io.Writer, chat, path string) error {
+	if err := sm.OpenStore(); err != nil {
+		return err
+	}
+	defer sm.Close()
+	chatID, err := sm.FindChat(chat)
+	if err != nil {
+		return err
+	}
+	count, err := sm.ImportChat(chatID, path)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "imported %d messages\n", count)
+	return nil
+}
+
+// parses a duration, additionally allowing days like "7d"
+func parseSince(value string) (time.Duration, error) {
+	if days := strings.TrimSuffix(value, "d"); days != value {
+		count, err := strconv.Atoi(days)
+		if err != nil || count < 0 {
+			return 0, errors.New("invalid duration: " + value)
+		}
+		return time.Duration(count) * 24 * time.Hour, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return 0, errors.New("invalid duration: " + value)
+	}
+	return duration, nil
+}
+
+// UiMessageHandler for one-shot subcommands, only errors and output written
+// to the writer are printed
+type cliHandler struct {
+	stderr io.Writer
+}
+
+func (c cliHandler) NewMessage(messages.Message)              {}
+func (c cliHandler) NewScreen([]messages.Message)             {}
+func (c cliHandler) SearchResults(string, []messages.Message) {}
+func (c cliHandler) SetChats([]messages.Chat)                 {}
+func (c cliHandler) PrintText(string)                         {}
+func (c cliHandler) PrintFile(string)                         {}
+func (c cliHandler) SetStatus(messages.SessionStatus)         {}
+func (c cliHandler) OpenFile(string)                          {}
+func (c cliHandler) GetWriter() io.Writer                     { return c.stderr }
+
+func (c cliHandler) PrintError(err error) {
+	if err != nil {
+		fmt.Fprintln(c.stderr, "error:", err)
+	}
+}
@@ -4,6 +4,11 @@ import (
 	"fmt"
 	"os"
 	"os/user"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/adrg/xdg"
 	"gopkg.in/ini.v1"
@@ -12,6 +17,16 @@ import (
 var configFilePath string
 var cfg *ini.File
 
+// DefaultAccount is the account that uses the session files of versions
+// without multiple accounts
+const DefaultAccount = "default"
+
+// the current account, switching accounts in the UI changes it while the
+// session managers of other accounts may read it
+var account = DefaultAccount
+var accountLock sync.RWMutex
+var accountNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
 type IniFile struct {
 	*General
 	*Keymap
@@ -24,10 +39,16 @@ type General struct {
 	PreviewPath         string
 	CmdPrefix           string
 	ShowCommand         string
+	RecordCommand       string
+	PlayCommand         string
 	EnableNotifications bool
 	UseTerminalBell     bool
 	NotificationTimeout int64
 	BacklogMsgQuantity  int
+	OutboxMaxRetries    int
+	SharePresence       bool
+	Accounts            string
+	ParallelAccounts    bool
 }
 
 type Keymap struct {
@@ -45,9 +66,17 @@ type Keymap struct {
 	MessageDownload string
 	MessageOpen     string
 	MessageShow     string
+	MessagePlay     string
 	MessageUrl      string
 	MessageInfo     string
 	MessageRevoke   string
+	MessageReply    string
+	MessageReact    string
+	MessageJump     string
+	MessageChat     string
+	MessageVote     string
+	ChatSwitcher    string
+	ChatWhois       string
 }
 
 type Ui struct {
@@ -67,6 +96,8 @@ type Colors struct {
 	InputBackground string
 	InputText       string
 	UnreadCount     string
+	ReadReceipt     string
+	Mention         string
 	Positive        string
 	Negative        string
 }
@@ -77,10 +108,16 @@ var Config = IniFile{
 		PreviewPath:         GetHomeDir() + "Downloads",
 		CmdPrefix:           "/",
 		ShowCommand:         "jp2a --color",
+		RecordCommand:       "arecord -q -f S16_LE -r 16000 -c 1",
+		PlayCommand:         "ffplay -nodisp -autoexit -loglevel quiet",
 		EnableNotifications: false,
 		UseTerminalBell:     false,
 		NotificationTimeout: 60,
 		BacklogMsgQuantity:  10,
+		OutboxMaxRetries:    5,
+		SharePresence:       false,
+		Accounts:            "",
+		ParallelAccounts:    false,
 	},
 	&Keymap{
 		SwitchPanels:    "Tab",
@@ -100,6 +137,14 @@ var Config = IniFile{
 		MessageUrl:      "u",
 		MessageRevoke:   "r",
 		MessageShow:     "s",
+		MessagePlay:     "p",
+		MessageReply:    "q",
+		MessageReact:    "+",
+		MessageJump:     "Enter",
+		MessageChat:     "c",
+		MessageVote:     "v",
+		ChatSwitcher:    "Ctrl+p",
+		ChatWhois:       "i",
 	},
 	&Ui{
 		ChatSidebarWidth: 30,
@@ -117,6 +162,8 @@ var Config = IniFile{
 		InputBackground: "blue",
 		InputText:       "white",
 		UnreadCount:     "yellow",
+		ReadReceipt:     "blue",
+		Mention:         "orange",
 		Positive:        "green",
 		Negative:        "red",
 	},
@@ -165,11 +212,76 @@ func GetConfigFilePath() string {
 	return configFilePath
 }
 
+// sets the account whose session is used, names may contain letters, digits, - and _
+func SetAccount(name string) error {
+	if !accountNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid account name %q, use letters, digits, - and _", name)
+	}
+	accountLock.Lock()
+	defer accountLock.Unlock()
+	account = name
+	return nil
+}
+
+// gets the name of the account whose session is used
+func GetAccount() string {
+	accountLock.RLock()
+	defer accountLock.RUnlock()
+	return account
+}
+
+// gets the names of the accounts listed in the config file or logged in
+// before, the default account first
+func GetAccounts() []string {
+	names := []string{DefaultAccount}
+	known := map[string]bool{DefaultAccount: true}
+	add := func(name string) {
+		if name != "" && !known[name] && accountNamePattern.MatchString(name) {
+			known[name] = true
+			names = append(names, name)
+		}
+	}
+	for _, name := range strings.Split(Config.General.Accounts, ",") {
+		add(strings.TrimSpace(name))
+	}
+	base := GetAccountSessionFilePath(DefaultAccount)
+	sessions, _ := filepath.Glob(base + "-*.db")
+	sort.Strings(sessions)
+	for _, session := range sessions {
+		name := strings.TrimSuffix(strings.TrimPrefix(session, base+"-"), ".db")
+		if !strings.Contains(name, ".") {
+			add(name)
+		}
+	}
+	return names
+}
+
+// gets the path of the session of the current account
 func GetSessionFilePath() string {
+	return GetAccountSessionFilePath(GetAccount())
+}
+
+// gets the path of the session of an account, other files of the account
+// are stored next to it
+func GetAccountSessionFilePath(name string) string {
+	suffix := ""
+	if name != DefaultAccount && name != "" {
+		suffix = "-" + name
+	}
 	if sessionFilePath, err := xdg.ConfigFile("whatscli/session"); err == nil {
-		return sessionFilePath
+		return sessionFilePath + suffix
 	}
-	return GetHomeDir() + ".whatscli.session"
+	return GetHomeDir() + ".whatscli.session" + suffix
+}
+
+// gets the path of the local message store of an account, next to the session database
+func GetMessageStoreFilePath(name string) string {
+	return GetAccountSessionFilePath(name) + ".messages.db"
+}
+
+// gets the path of the control socket used in daemon mode
+func GetSocketFilePath() string {
+	return GetSessionFilePath() + ".sock"
 }
 
 // gets the OS home dir with a path separator at the end
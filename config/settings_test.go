@@ -0,0 +1,49 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/adrg/xdg"
+)
+
+func TestAccountFilePaths(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	xdg.Reload()
+	defer SetAccount(DefaultAccount)
+
+	base := filepath.Join(dir, "whatscli", "session")
+	paths := map[string]string{
+		DefaultAccount: base,
+		"":             base,
+		"work":         base + "-work",
+		"my_second-2":  base + "-my_second-2",
+	}
+	for name, expected := range paths {
+		if path := GetAccountSessionFilePath(name); path != expected {
+			t.Fatalf("unexpected session path for %q: %s", name, path)
+		}
+		if path := GetMessageStoreFilePath(name); path != expected+".messages.db" {
+			t.Fatalf("unexpected message store path for %q: %s", name, path)
+		}
+	}
+
+	if GetAccount() != DefaultAccount || GetSessionFilePath() != base {
+		t.Fatalf("expected the default account, got %q at %s", GetAccount(), GetSessionFilePath())
+	}
+	if err := SetAccount("work"); err != nil {
+		t.Fatalf("expected valid account name: %v", err)
+	}
+	if GetAccount() != "work" || GetSessionFilePath() != base+"-work" {
+		t.Fatalf("unexpected account %q at %s", GetAccount(), GetSessionFilePath())
+	}
+	for _, name := range []string{"", "../other", "a b", "work/x", "work.db", "ä"} {
+		if err := SetAccount(name); err == nil {
+			t.Fatalf("expected %q to be rejected", name)
+		}
+	}
+	if GetAccount() != "work" {
+		t.Fatalf("expected invalid names to keep the account, got %q", GetAccount())
+	}
+}
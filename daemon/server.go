@@ -0,0 +1,340 @@
+// this package runs the session manager without UI and exposes it
+// through a JSON-RPC socket
+package daemon
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/normen/whatscli/messages"
+)
+
+// color and region tags, and escaped brackets as produced by tview.Escape
+var tagPattern = regexp.MustCompile(`\[[a-zA-Z0-9_,;: \-\."#]*\]`)
+var escapedPattern = regexp.MustCompile(`\[([a-zA-Z0-9_,;: \-\."#]*)\[\]`)
+
+// JSON-RPC 2.0 request
+type Request struct {
+	Version string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  []string        `json:"params,omitempty"`
+}
+
+// JSON-RPC 2.0 response or notification (without id)
+type Response struct {
+	Version string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  interface{}     `json:"params,omitempty"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// JSON-RPC 2.0 error object
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Server owns a session manager and serves it on a unix domain socket.
+// It implements messages.UiMessageHandler and sends all UI updates as
+// notifications to subscribed connections.
+type Server struct {
+	SessionManager *messages.SessionManager
+	Log            io.Writer
+	listener       net.Listener
+	conns          map[*conn]struct{}
+	lock           sync.Mutex
+	commandLock    sync.Mutex // one command of a request runs at a time
+	running        bool       // a command of a request is running
+	commandErr     error      // the first error the running command printed
+}
+
+type conn struct {
+	net.Conn
+	writeLock  sync.Mutex
+	subscribed bool
+}
+
+// Run starts a daemon on the socket at path and blocks until it receives
+// an interrupt or termination signal and the session is closed.
+func Run(path string, log io.Writer) error {
+	server := &Server{}
+	server.Init(log)
+	if err := server.Listen(path); err != nil {
+		return err
+	}
+	defer os.Remove(path)
+	if err := server.SessionManager.StartManager(); err != nil {
+		server.Close()
+		return err
+	}
+	server.log("listening on " + path)
+	go server.Serve()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+	err := server.SessionManager.StopManager()
+	if closeErr := server.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Init creates the session manager with the server as its UI handler.
+func (s *Server) Init(log io.Writer) {
+	s.Log = log
+	s.conns = make(map[*conn]struct{})
+	s.SessionManager = &messages.SessionManager{}
+	s.SessionManager.Init(s)
+}
+
+// Listen opens the socket at path, a stale socket file is replaced.
+func (s *Server) Listen(path string) error {
+	if c, err := net.Dial("unix", path); err == nil {
+		c.Close()
+		return fmt.Errorf("another daemon is listening on %s", path)
+	}
+	os.Remove(path)
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("failed to open control socket: %v", err)
+	}
+	if err = os.Chmod(path, 0o600); err != nil {
+		listener.Close()
+		return err
+	}
+	s.listener = listener
+	return nil
+}
+
+// Serve accepts connections until the listener is closed.
+func (s *Server) Serve() error {
+	for {
+		c, err := s.listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.ServeConn(c)
+	}
+}
+
+// Close closes the socket and all open connections.
+func (s *Server) Close() error {
+	s.lock.Lock()
+	for c := range s.conns {
+		c.Close()
+	}
+	s.lock.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+// ServeConn reads newline delimited requests from a connection and answers them.
+func (s *Server) ServeConn(nc net.Conn) {
+	c := &conn{Conn: nc}
+	s.lock.Lock()
+	s.conns[c] = struct{}{}
+	s.lock.Unlock()
+	defer func() {
+		s.lock.Lock()
+		delete(s.conns, c)
+		s.lock.Unlock()
+		c.Close()
+	}()
+
+	scanner := bufio.NewScanner(c)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		var req Request
+		if err := json.Unmarshal(line, &req); err != nil {
+			s.send(c, Response{Error: &Error{-32700, "parse error: " + err.Error()}})
+			continue
+		}
+		resp := s.handle(c, req)
+		if req.Id != nil {
+			resp.Id = req.Id
+			s.send(c, resp)
+		}
+	}
+}
+
+func (s *Server) handle(c *conn, req Request) Response {
+	switch {
+	case req.Method == "subscribe":
+		s.lock.Lock()
+		c.subscribed = true
+		s.lock.Unlock()
+		return Response{Result: true}
+	case req.Method == "unsubscribe":
+		s.lock.Lock()
+		c.subscribed = false
+		s.lock.Unlock()
+		return Response{Result: true}
+	case req.Method == "chats":
+		return Response{Result: s.SessionManager.GetChats()}
+	case req.Method == "messages":
+		if len(req.Params) < 1 {
+			return Response{Error: &Error{-32602, "usage: messages [chat-id]"}}
+		}
+		return Response{Result: s.SessionManager.GetMessages(req.Params[0])}
+	case messages.IsCommand(req.Method):
+		// all commands of the session manager, with the params as command parameters
+		if err := s.runCommand(messages.Command{Name: req.Method, Params: req.Params}); err != nil {
+			return Response{Error: &Error{-32000, err.Error()}}
+		}
+		return Response{Result: true}
+	}
+	return Response{Error: &Error{-32601, "method not found: " + req.Method}}
+}
+
+// runCommand runs a command of the session manager and waits for it. An
+// error or wrong usage it prints meanwhile is returned.
+func (s *Server) runCommand(command messages.Command) error {
+	s.commandLock.Lock()
+	defer s.commandLock.Unlock()
+	s.lock.Lock()
+	s.running = true
+	s.commandErr = nil
+	s.lock.Unlock()
+	done := make(chan struct{})
+	s.SessionManager.RequestChannel <- messages.CommandRequest{Command: command, Done: done}
+	<-done
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.running = false
+	return s.commandErr
+}
+
+// recordError keeps the first error printed while a command runs
+func (s *Server) recordError(err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.running && s.commandErr == nil {
+		s.commandErr = err
+	}
+}
+
+func (s *Server) send(c *conn, resp Response) {
+	resp.Version = "2.0"
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return
+	}
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	c.Write(append(data, '\n'))
+}
+
+// notify sends a notification to all subscribed connections
+func (s *Server) notify(method string, params interface{}) {
+	s.lock.Lock()
+	subscribers := make([]*conn, 0, len(s.conns))
+	for c := range s.conns {
+		if c.subscribed {
+			subscribers = append(subscribers, c)
+		}
+	}
+	s.lock.Unlock()
+	for _, c := range subscribers {
+		s.send(c, Response{Method: method, Params: params})
+	}
+}
+
+// log writes a line to the log without color tags
+func (s *Server) log(text string) {
+	if s.Log != nil {
+		fmt.Fprintln(s.Log, stripTags(text))
+	}
+}
+
+func stripTags(text string) string {
+	text = escapedPattern.ReplaceAllString(text, "\x00$1\x01")
+	text = tagPattern.ReplaceAllString(text, "")
+	return strings.NewReplacer("\x00", "[", "\x01", "]").Replace(text)
+}
+
+func (s *Server) NewMessage(msg messages.Message) {
+	s.notify("message", msg)
+}
+
+func (s *Server) NewScreen(msgs []messages.Message) {
+	s.notify("screen", msgs)
+}
+
+func (s *Server) SearchResults(query string, msgs []messages.Message) {
+	s.notify("search", map[string]interface{}{"query": query, "messages": msgs})
+}
+
+func (s *Server) SetChats(chats []messages.Chat) {
+	s.notify("chats", chats)
+}
+
+func (s *Server) PrintError(err error) {
+	if err == nil {
+		return
+	}
+	s.log("error: " + err.Error())
+	s.recordError(errors.New(stripTags(err.Error())))
+	s.notify("error", stripTags(err.Error()))
+}
+
+func (s *Server) PrintText(text string) {
+	s.log(text)
+	if plain := stripTags(text); strings.HasPrefix(plain, "Usage: ") {
+		s.recordError(errors.New(plain))
+	}
+	s.notify("text", stripTags(text))
+}
+
+// PrintQRCode writes the login QR code to the log and sends it to the
+// subscribers as is, the color tag pipeline would turn it into spaces
+func (s *Server) PrintQRCode(code string) {
+	if s.Log != nil {
+		fmt.Fprint(s.Log, code)
+	}
+	s.notify("qr", code)
+}
+
+func (s *Server) PrintFile(path string) {
+	s.notify("file", path)
+}
+
+func (s *Server) OpenFile(path string) {
+	s.notify("open", path)
+}
+
+func (s *Server) SetStatus(status messages.SessionStatus) {
+	s.notify("status", status)
+}
+
+func (s *Server) GetWriter() io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		s.PrintText(strings.TrimRight(string(p), "\n"))
+		return len(p), nil
+	})
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (w writerFunc) Write(p []byte) (int, error) {
+	return w(p)
+}
@@ -0,0 +1,146 @@
+package daemon
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/normen/whatscli/messages"
+)
+
+// serveRequests runs the command requests of the server like the session
+// manager would, run is called for each command
+func serveRequests(server *Server, run func(messages.Command)) {
+	go func() {
+		for request := range server.SessionManager.RequestChannel {
+			run(request.Command)
+			close(request.Done)
+		}
+	}()
+}
+
+func TestServeConnRunsCommandsAndNotifies(t *testing.T) {
+	server := &Server{}
+	server.Init(nil)
+	commands := make(chan messages.Command, 10)
+	serveRequests(server, func(command messages.Command) {
+		switch command.Params[0] {
+		case "bad":
+			server.PrintError(errors.New("invalid JID"))
+		case "usage":
+			server.PrintText("[red]Usage:[-] send [chat-id[] [message text[]")
+		}
+		commands <- command
+	})
+	client, remote := net.Pipe()
+	defer client.Close()
+	go server.ServeConn(remote)
+	reader := bufio.NewReader(client)
+
+	call := func(line string) Response {
+		if _, err := client.Write([]byte(line + "\n")); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		data, err := reader.ReadBytes('\n')
+		if err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+		var resp Response
+		if err = json.Unmarshal(data, &resp); err != nil {
+			t.Fatalf("invalid response %q: %v", data, err)
+		}
+		return resp
+	}
+
+	resp := call(`{"jsonrpc":"2.0","id":1,"method":"send","params":["123@s.whatsapp.net","hello there"]}`)
+	if resp.Error != nil || resp.Result != true || string(resp.Id) != "1" {
+		t.Fatalf("unexpected response: %#v", resp)
+	}
+	command := <-commands
+	if command.Name != "send" || len(command.Params) != 2 || command.Params[1] != "hello there" {
+		t.Fatalf("unexpected command: %#v", command)
+	}
+	resp = call(`{"jsonrpc":"2.0","id":5,"method":"send","params":["bad","hello"]}`)
+	if resp.Error == nil || resp.Error.Code != -32000 || resp.Error.Message != "invalid JID" {
+		t.Fatalf("expected the error of the command, got %#v", resp)
+	}
+	resp = call(`{"jsonrpc":"2.0","id":6,"method":"send","params":["usage"]}`)
+	if resp.Error == nil || resp.Error.Message != "Usage: send [chat-id] [message text]" {
+		t.Fatalf("expected the usage of the command, got %#v", resp)
+	}
+	if resp = call(`{"jsonrpc":"2.0","id":7,"method":"send","params":["ok","again"]}`); resp.Error != nil {
+		t.Fatalf("expected an earlier error to be forgotten, got %#v", resp.Error)
+	}
+
+	if resp = call(`{"jsonrpc":"2.0","id":2,"method":"frobnicate"}`); resp.Error == nil || resp.Error.Code != -32601 {
+		t.Fatalf("expected method not found, got %#v", resp)
+	}
+	if resp = call(`{"jsonrpc":"2.0","id":3,"method":"chats"}`); resp.Error != nil {
+		t.Fatalf("unexpected error: %#v", resp.Error)
+	}
+
+	call(`{"jsonrpc":"2.0","id":4,"method":"subscribe"}`)
+	go server.PrintText("[red]Usage:[-] select [chat-id[]")
+	data, err := reader.ReadBytes('\n')
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	var note Response
+	json.Unmarshal(data, &note)
+	if note.Method != "text" || note.Params != "Usage: select [chat-id]" || note.Id != nil {
+		t.Fatalf("unexpected notification: %s", data)
+	}
+}
+
+func TestAllCommandsReachable(t *testing.T) {
+	server := &Server{}
+	server.Init(nil)
+	commands := make(chan messages.Command, 1)
+	serveRequests(server, func(command messages.Command) { commands <- command })
+	c := &conn{}
+	for _, name := range messages.Commands() {
+		resp := server.handle(c, Request{Method: name, Params: []string{"param"}})
+		if resp.Error != nil {
+			t.Fatalf("command %s not reachable: %#v", name, resp.Error)
+		}
+		if command := <-commands; command.Name != name {
+			t.Fatalf("unexpected command for %s: %#v", name, command)
+		}
+	}
+	for _, name := range []string{"whois", "invitelink", "join", "description", "announce", "locked", "approval",
+		"disappearing", "sendcontact", "sendlocation", "sendsticker", "voice", "play", "poll", "vote"} {
+		if !messages.IsCommand(name) {
+			t.Fatalf("expected %s to be a command", name)
+		}
+	}
+}
+
+func TestPrintQRCodeKeepsColors(t *testing.T) {
+	log := &bytes.Buffer{}
+	server := &Server{}
+	server.Init(log)
+	client, remote := net.Pipe()
+	defer client.Close()
+	go server.ServeConn(remote)
+	reader := bufio.NewReader(client)
+	client.Write([]byte(`{"jsonrpc":"2.0","id":1,"method":"subscribe"}` + "\n"))
+	reader.ReadBytes('\n')
+
+	code := "\x1b[40m  \x1b[0m\x1b[47m  \x1b[0m\n"
+	go server.PrintQRCode(code)
+	data, err := reader.ReadBytes('\n')
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	var note Response
+	json.Unmarshal(data, &note)
+	if note.Method != "qr" || note.Params != code {
+		t.Fatalf("unexpected notification: %s", data)
+	}
+	if log.String() != code {
+		t.Fatalf("unexpected log: %q", log.String())
+	}
+}
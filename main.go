@@ -2,15 +2,19 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
+	"regexp"
 	"strings"
 	"time"
 
 	"codeberg.org/tslocum/cbind"
 	"github.com/gdamore/tcell/v2"
 	"github.com/normen/whatscli/config"
+	"github.com/normen/whatscli/daemon"
 	"github.com/normen/whatscli/messages"
 	"github.com/rivo/tview"
 	"github.com/skratchdot/open-golang/open"
@@ -22,6 +26,16 @@ var VERSION string = "v1.1.6"
 var sndTxt string = ""
 var currentReceiver messages.Chat = messages.Chat{}
 var curRegions []messages.Message
+var curChats []messages.Chat
+
+// search results are shown instead of a chat, jumpHighlight is the
+// message to highlight once the jumped-to chat is loaded
+var showingSearch bool
+var jumpHighlight string
+
+// chat and time of the last typing notification that was sent
+var typingChat string
+var typingSent time.Time
 
 var textView *tview.TextView
 var treeView *tview.TreeView
@@ -31,6 +45,17 @@ var infoBar *tview.TextView
 
 var chatRoot *tview.TreeNode
 var app *tview.Application
+var pages *tview.Pages
+
+// global key bindings are disabled while the chat switcher is open
+var switcherOpen bool
+
+// maximum number of chats shown in the chat switcher
+const switcherLimit = 50
+
+// the candidates shown while completing the input text
+var completionList *tview.List
+var completions []messages.Completion
 
 var sessionManager *messages.SessionManager
 
@@ -39,10 +64,33 @@ var keyBindings *cbind.Configuration
 var uiHandler messages.UiMessageHandler
 
 func main() {
+	daemonMode := flag.Bool("daemon", false, "run without UI and serve a JSON-RPC control socket")
+	accountName := flag.String("account", config.DefaultAccount, "name of the WhatsApp account to use")
+	flag.Usage = func() {
+		printSubcommandUsage(flag.CommandLine.Output())
+		flag.PrintDefaults()
+	}
+	flag.Parse()
 	config.InitConfig()
-	uiHandler = UiHandler{}
+	if err := config.SetAccount(*accountName); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if flag.NArg() > 0 {
+		os.Exit(RunSubcommand(flag.Args(), os.Stdout, os.Stderr))
+	}
+	if *daemonMode {
+		if err := daemon.Run(config.GetSocketFilePath(), os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	activeAccount.Store(config.GetAccount())
+	uiHandler = UiHandler{account: config.GetAccount()}
 	sessionManager = &messages.SessionManager{}
 	sessionManager.Init(uiHandler)
+	sessionManagers[config.GetAccount()] = sessionManager
 
 	app = tview.NewApplication()
 
@@ -54,11 +102,10 @@ func main() {
 	gridLayout.SetBackgroundColor(tcell.ColorNames[config.Config.Colors.Background])
 	gridLayout.SetBordersColor(tcell.ColorNames[config.Config.Colors.Borders])
 
-	cmdPrefix := config.Config.General.CmdPrefix
 	topBar = tview.NewTextView()
 	topBar.SetDynamicColors(true)
 	topBar.SetScrollable(false)
-	topBar.SetText("[::b] WhatsCLI " + VERSION + "  [-::d]Type " + cmdPrefix + "help or press " + config.Config.Keymap.CommandHelp + " for help")
+	UpdateTopBar("")
 	topBar.SetBackgroundColor(tcell.ColorNames[config.Config.Colors.Background])
 
 	infoBar = tview.NewTextView()
@@ -83,9 +130,16 @@ func main() {
 	textInput.SetFieldTextColor(tcell.ColorNames[config.Config.Colors.InputText])
 	textInput.SetChangedFunc(func(change string) {
 		sndTxt = change
+		updateTyping(change)
 	})
 	textInput.SetDoneFunc(EnterCommand)
 	textInput.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if completionList != nil {
+			return handleCompletionKey(event)
+		}
+		if event.Key() == tcell.KeyTab && CompleteInput() {
+			return nil
+		}
 		if event.Key() == tcell.KeyDown {
 			offset, _ := textView.GetScrollOffset()
 			offset += 1
@@ -119,12 +173,17 @@ func main() {
 	gridLayout.AddItem(textView, 1, 1, 1, 3, 0, 0, false)
 	gridLayout.AddItem(textInput, 2, 1, 1, 3, 0, 0, false)
 
-	app.SetRoot(gridLayout, true)
+	pages = tview.NewPages()
+	pages.AddPage("main", gridLayout, true, true)
+	app.SetRoot(pages, true)
 	app.EnableMouse(true)
 	app.SetFocus(textInput)
 	if err := sessionManager.StartManager(); err != nil {
 		PrintError(err)
 	}
+	if config.Config.General.ParallelAccounts {
+		startAccounts()
+	}
 	LoadShortcuts()
 	app.Run()
 }
@@ -143,7 +202,7 @@ func MakeTree() *tview.TreeView {
 	treeView.SetChangedFunc(func(node *tview.TreeNode) {
 		reference := node.GetReference()
 		if reference == nil {
-			SetDisplayedChat(messages.Chat{"", false, "", 0, 0})
+			SetDisplayedChat(messages.Chat{})
 			return // Selecting the root node does nothing.
 		}
 		children := node.GetChildren()
@@ -159,6 +218,181 @@ func MakeTree() *tview.TreeView {
 	return treeView
 }
 
+func handleChatSwitcher(ev *tcell.EventKey) *tcell.EventKey {
+	ShowChatSwitcher()
+	return nil
+}
+
+// shows a popup to find a chat or contact by name or number and switch to it
+func ShowChatSwitcher() {
+	if switcherOpen {
+		return
+	}
+	switcherOpen = true
+	input := tview.NewInputField().SetLabel("Chat: ")
+	input.SetBackgroundColor(tcell.ColorNames[config.Config.Colors.Background])
+	input.SetFieldBackgroundColor(tcell.ColorNames[config.Config.Colors.InputBackground])
+	input.SetFieldTextColor(tcell.ColorNames[config.Config.Colors.InputText])
+	list := tview.NewList().ShowSecondaryText(false).SetHighlightFullLine(true)
+	list.SetBackgroundColor(tcell.ColorNames[config.Config.Colors.Background])
+	list.SetMainTextColor(tcell.ColorNames[config.Config.Colors.Text])
+
+	var results []messages.Chat
+	update := func(query string) {
+		results = sessionManager.FuzzyChats(query, switcherLimit)
+		list.Clear()
+		for _, chat := range results {
+			color := config.Config.Colors.ListContact
+			if chat.IsGroup {
+				color = config.Config.Colors.ListGroup
+			}
+			list.AddItem("["+color+"]"+getChatListName(chat), "", 0, nil)
+		}
+	}
+	closeSwitcher := func() {
+		pages.RemovePage("switcher")
+		switcherOpen = false
+		app.SetFocus(textInput)
+	}
+	choose := func() {
+		if len(results) == 0 {
+			return
+		}
+		chat := results[list.GetCurrentItem()]
+		closeSwitcher()
+		selectChat(chat)
+	}
+	input.SetChangedFunc(update)
+	input.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyDown:
+			if list.GetItemCount() > 0 {
+				list.SetCurrentItem((list.GetCurrentItem() + 1) % list.GetItemCount())
+			}
+			return nil
+		case tcell.KeyUp:
+			// negative indices count from the end
+			list.SetCurrentItem(list.GetCurrentItem() - 1)
+			return nil
+		case tcell.KeyEnter:
+			choose()
+			return nil
+		case tcell.KeyEsc:
+			closeSwitcher()
+			return nil
+		}
+		return event
+	})
+	list.SetSelectedFunc(func(int, string, string, rune) {
+		choose()
+	})
+	update("")
+
+	box := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(input, 1, 0, true).
+		AddItem(list, 0, 1, false)
+	box.SetBorder(true).SetTitle(" Switch chat ")
+	box.SetBorderColor(tcell.ColorNames[config.Config.Colors.Borders])
+	box.SetBackgroundColor(tcell.ColorNames[config.Config.Colors.Background])
+	modal := tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(nil, 0, 1, false).
+			AddItem(box, 20, 0, true).
+			AddItem(nil, 0, 1, false), 60, 0, true).
+		AddItem(nil, 0, 1, false)
+	pages.AddPage("switcher", modal, true, true)
+	app.SetFocus(input)
+}
+
+// completes the text of the input field, shows a list if there are several
+// candidates, returns false if there is nothing to complete
+func CompleteInput() bool {
+	candidates := sessionManager.Complete(textInput.GetText(), currentReceiver.Id)
+	switch len(candidates) {
+	case 0:
+		return false
+	case 1:
+		textInput.SetText(candidates[0].Text)
+		return true
+	}
+	completions = candidates
+	completionList = tview.NewList().ShowSecondaryText(false).SetHighlightFullLine(true)
+	completionList.SetBackgroundColor(tcell.ColorNames[config.Config.Colors.InputBackground])
+	completionList.SetMainTextColor(tcell.ColorNames[config.Config.Colors.InputText])
+	width := 0
+	for _, candidate := range candidates {
+		completionList.AddItem(tview.Escape(candidate.Display), "", 0, nil)
+		if len(candidate.Display) > width {
+			width = len(candidate.Display)
+		}
+	}
+	completionList.SetSelectedFunc(func(idx int, _ string, _ string, _ rune) {
+		chooseCompletion(idx)
+	})
+	height := len(candidates)
+	if height > 10 {
+		height = 10
+	}
+	dropdown := tview.NewFlex().
+		AddItem(nil, config.Config.Ui.ChatSidebarWidth, 0, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(nil, 0, 1, false).
+			AddItem(completionList, height, 0, false).
+			AddItem(nil, 1, 0, false), width+2, 0, false).
+		AddItem(nil, 0, 1, false)
+	pages.AddPage("completion", dropdown, true, true)
+	app.SetFocus(textInput)
+	return true
+}
+
+// handles the keys while the list of completions is shown
+func handleCompletionKey(event *tcell.EventKey) *tcell.EventKey {
+	count := completionList.GetItemCount()
+	switch event.Key() {
+	case tcell.KeyTab, tcell.KeyDown:
+		completionList.SetCurrentItem((completionList.GetCurrentItem() + 1) % count)
+		return nil
+	case tcell.KeyBacktab, tcell.KeyUp:
+		// negative indices count from the end
+		completionList.SetCurrentItem(completionList.GetCurrentItem() - 1)
+		return nil
+	case tcell.KeyEnter:
+		chooseCompletion(completionList.GetCurrentItem())
+		return nil
+	case tcell.KeyEsc:
+		closeCompletion()
+		return nil
+	}
+	closeCompletion()
+	return event
+}
+
+func chooseCompletion(idx int) {
+	text := completions[idx].Text
+	closeCompletion()
+	textInput.SetText(text)
+}
+
+func closeCompletion() {
+	pages.RemovePage("completion")
+	completionList = nil
+	completions = nil
+	app.SetFocus(textInput)
+}
+
+// shows a chat and selects it in the chat list
+func selectChat(chat messages.Chat) {
+	for _, node := range chatRoot.GetChildren() {
+		if reference, ok := node.GetReference().(messages.Chat); ok && reference.Id == chat.Id {
+			treeView.SetCurrentNode(node)
+			chat = reference
+			break
+		}
+	}
+	SetDisplayedChat(chat)
+}
+
 func handleFocusMessage(ev *tcell.EventKey) *tcell.EventKey {
 	if !textView.HasFocus() {
 		app.SetFocus(textView)
@@ -186,6 +420,10 @@ func handleFocusContacts(ev *tcell.EventKey) *tcell.EventKey {
 }
 
 func handleSwitchPanels(ev *tcell.EventKey) *tcell.EventKey {
+	// tab completes the input if there is anything to complete
+	if textInput.HasFocus() && ev.Key() == tcell.KeyTab && CompleteInput() {
+		return nil
+	}
 	ResetMsgSelection()
 	if !textInput.HasFocus() {
 		app.SetFocus(textInput)
@@ -237,7 +475,7 @@ func safeReadClipboard() (clip string, err error) {
 }
 
 func handleQuit(ev *tcell.EventKey) *tcell.EventKey {
-	sessionManager.CommandChannel <- messages.Command{"disconnect", nil}
+	disconnectAccounts()
 	app.Stop()
 	return nil
 }
@@ -259,6 +497,60 @@ func handleMessageCommand(command string) func(ev *tcell.EventKey) *tcell.EventK
 	}
 }
 
+// prefills the input with a command for the selected message
+func handleMessageInput(command string) func(ev *tcell.EventKey) *tcell.EventKey {
+	return func(ev *tcell.EventKey) *tcell.EventKey {
+		hls := textView.GetHighlights()
+		if len(hls) > 0 {
+			textInput.SetText(config.Config.General.CmdPrefix + command + " " + hls[0] + " ")
+			ResetMsgSelection()
+			app.SetFocus(textInput)
+		}
+		return nil
+	}
+}
+
+func handleMessageJump(ev *tcell.EventKey) *tcell.EventKey {
+	hls := textView.GetHighlights()
+	if !showingSearch || len(hls) == 0 {
+		return nil
+	}
+	for _, msg := range curRegions {
+		if msg.Id == hls[0] {
+			jumpHighlight = msg.Id
+			SetDisplayedChat(getChat(msg.ChatId))
+			return nil
+		}
+	}
+	return nil
+}
+
+// starts a chat with the contact shared in the selected message
+func handleMessageContactChat(ev *tcell.EventKey) *tcell.EventKey {
+	hls := textView.GetHighlights()
+	if len(hls) == 0 {
+		return nil
+	}
+	for _, msg := range curRegions {
+		if msg.Id != hls[0] {
+			continue
+		}
+		chat, err := messages.ContactCardChat(msg)
+		if err != nil {
+			PrintError(err)
+			return nil
+		}
+		if known := getChat(chat.Id); known.Name != "" {
+			chat = known
+		}
+		ResetMsgSelection()
+		SetDisplayedChat(chat)
+		app.SetFocus(textInput)
+		return nil
+	}
+	return nil
+}
+
 func handleMessagesMove(amount int) func(ev *tcell.EventKey) *tcell.EventKey {
 	return func(ev *tcell.EventKey) *tcell.EventKey {
 		if curRegions == nil || len(curRegions) == 0 {
@@ -291,6 +583,16 @@ func handleChatPanelDown(ev *tcell.EventKey) *tcell.EventKey {
 	return ev
 }
 
+// shows details about the chat selected in the chat panel
+func handleChatWhois(ev *tcell.EventKey) *tcell.EventKey {
+	if node := treeView.GetCurrentNode(); node != nil {
+		if chat, ok := node.GetReference().(messages.Chat); ok {
+			sessionManager.CommandChannel <- messages.Command{"whois", []string{chat.Id}}
+		}
+	}
+	return nil
+}
+
 func handleMessagesLast(ev *tcell.EventKey) *tcell.EventKey {
 	if curRegions == nil || len(curRegions) == 0 {
 		return nil
@@ -355,7 +657,15 @@ func LoadShortcuts() {
 	if err := keyBindings.Set(config.Config.Keymap.CommandHelp, handleHelp); err != nil {
 		PrintErrorMsg("command_help:", err)
 	}
-	app.SetInputCapture(keyBindings.Capture)
+	if err := keyBindings.Set(config.Config.Keymap.ChatSwitcher, handleChatSwitcher); err != nil {
+		PrintErrorMsg("chat_switcher:", err)
+	}
+	app.SetInputCapture(func(ev *tcell.EventKey) *tcell.EventKey {
+		if switcherOpen || completionList != nil {
+			return ev
+		}
+		return keyBindings.Capture(ev)
+	})
 	// bindings for chat message text view
 	keysMessages := cbind.NewConfiguration()
 	if err := keysMessages.Set(config.Config.Keymap.MessageDownload, handleMessageCommand("download")); err != nil {
@@ -373,6 +683,9 @@ func LoadShortcuts() {
 	if err := keysMessages.Set(config.Config.Keymap.MessageShow, handleMessageCommand("show")); err != nil {
 		PrintErrorMsg("message_show:", err)
 	}
+	if err := keysMessages.Set(config.Config.Keymap.MessagePlay, handleMessageCommand("play")); err != nil {
+		PrintErrorMsg("message_play:", err)
+	}
 	if err := keysMessages.Set(config.Config.Keymap.MessageUrl, handleMessageCommand("url")); err != nil {
 		PrintErrorMsg("message_url:", err)
 	}
@@ -382,6 +695,21 @@ func LoadShortcuts() {
 	if err := keysMessages.Set(config.Config.Keymap.MessageRevoke, handleMessageCommand("revoke")); err != nil {
 		PrintErrorMsg("message_revoke:", err)
 	}
+	if err := keysMessages.Set(config.Config.Keymap.MessageReply, handleMessageInput("reply")); err != nil {
+		PrintErrorMsg("message_reply:", err)
+	}
+	if err := keysMessages.Set(config.Config.Keymap.MessageReact, handleMessageInput("react")); err != nil {
+		PrintErrorMsg("message_react:", err)
+	}
+	if err := keysMessages.Set(config.Config.Keymap.MessageChat, handleMessageContactChat); err != nil {
+		PrintErrorMsg("message_chat:", err)
+	}
+	if err := keysMessages.Set(config.Config.Keymap.MessageVote, handleMessageInput("vote")); err != nil {
+		PrintErrorMsg("message_vote:", err)
+	}
+	if err := keysMessages.Set(config.Config.Keymap.MessageJump, handleMessageJump); err != nil {
+		PrintErrorMsg("message_jump:", err)
+	}
 	keysMessages.SetKey(tcell.ModNone, tcell.KeyEscape, handleExitMessages)
 	keysMessages.SetKey(tcell.ModNone, tcell.KeyUp, handleMessagesMove(-1))
 	keysMessages.SetKey(tcell.ModNone, tcell.KeyDown, handleMessagesMove(1))
@@ -395,6 +723,9 @@ func LoadShortcuts() {
 	keysMessages.SetRune(tcell.ModCtrl, 'd', handleMessagesMove(10))
 	textView.SetInputCapture(keysMessages.Capture)
 	keysChatPanel := cbind.NewConfiguration()
+	if err := keysChatPanel.Set(config.Config.Keymap.ChatWhois, handleChatWhois); err != nil {
+		PrintErrorMsg("chat_whois:", err)
+	}
 	keysChatPanel.SetRune(tcell.ModCtrl, 'u', handleChatPanelUp)
 	keysChatPanel.SetRune(tcell.ModCtrl, 'd', handleChatPanelDown)
 	treeView.SetInputCapture(keysChatPanel.Capture)
@@ -407,18 +738,28 @@ func PrintHelp() {
 	fmt.Fprintln(textView, "")
 	fmt.Fprintln(textView, "Global")
 	fmt.Fprintln(textView, "[::b] Up/Down[::-] = Scroll history/chats")
-	fmt.Fprintln(textView, "[::b]", config.Config.Keymap.SwitchPanels, "[::-] = Switch input/chats")
+	fmt.Fprintln(textView, "[::b]", config.Config.Keymap.SwitchPanels, "[::-] = Switch input/chats, complete commands, ids, paths and @mentions")
 	fmt.Fprintln(textView, "[::b]", config.Config.Keymap.FocusMessages, "[::-] = Focus message panel")
+	fmt.Fprintln(textView, "[::b]", config.Config.Keymap.ChatSwitcher, "[::-] = Find and switch chat")
 	fmt.Fprintln(textView, "[::b]", config.Config.Keymap.CommandQuit, "[::-] = Exit app")
 	fmt.Fprintln(textView, "")
 	fmt.Fprintln(textView, "[-::-]Message panel[-::-]")
 	fmt.Fprintln(textView, "[::b] Up/Down[::-] = select message")
-	fmt.Fprintln(textView, "[::b]", config.Config.Keymap.MessageDownload, "[::-] = Download attachment")
+	fmt.Fprintln(textView, "[::b]", config.Config.Keymap.MessageDownload, "[::-] = Download attachment or contact card")
 	fmt.Fprintln(textView, "[::b]", config.Config.Keymap.MessageOpen, "[::-] = Download & open attachment")
-	fmt.Fprintln(textView, "[::b]", config.Config.Keymap.MessageShow, "[::-] = Download & show image using", config.Config.General.ShowCommand)
-	fmt.Fprintln(textView, "[::b]", config.Config.Keymap.MessageUrl, "[::-] = Find URL in message and open it")
+	fmt.Fprintln(textView, "[::b]", config.Config.Keymap.MessageShow, "[::-] = Download & show image or sticker using", config.Config.General.ShowCommand)
+	fmt.Fprintln(textView, "[::b]", config.Config.Keymap.MessagePlay, "[::-] = Play voice note or audio using", config.Config.General.PlayCommand)
+	fmt.Fprintln(textView, "[::b]", config.Config.Keymap.MessageUrl, "[::-] = Find URL in message and open it, locations open on the map")
 	fmt.Fprintln(textView, "[::b]", config.Config.Keymap.MessageRevoke, "[::-] = Revoke message")
 	fmt.Fprintln(textView, "[::b]", config.Config.Keymap.MessageInfo, "[::-] = Info about message")
+	fmt.Fprintln(textView, "[::b]", config.Config.Keymap.MessageReply, "[::-] = Reply to message")
+	fmt.Fprintln(textView, "[::b]", config.Config.Keymap.MessageReact, "[::-] = React to message")
+	fmt.Fprintln(textView, "[::b]", config.Config.Keymap.MessageChat, "[::-] = Start chat with shared contact")
+	fmt.Fprintln(textView, "[::b]", config.Config.Keymap.MessageVote, "[::-] = Vote on poll with option numbers")
+	fmt.Fprintln(textView, "[::b]", config.Config.Keymap.MessageJump, "[::-] = Jump to search result")
+	fmt.Fprintln(textView, "")
+	fmt.Fprintln(textView, "[-::-]Chat panel[-::-]")
+	fmt.Fprintln(textView, "[::b]", config.Config.Keymap.ChatWhois, "[::-] = Details about contact or group")
 	fmt.Fprintln(textView, "")
 	fmt.Fprintln(textView, "Config file in ->", config.GetConfigFilePath())
 	fmt.Fprintln(textView, "")
@@ -436,20 +777,43 @@ func PrintCommands() {
 	fmt.Fprintln(textView, "[::b] "+cmdPrefix+"disconnect[::-]  = Close the connection")
 	fmt.Fprintln(textView, "[::b] "+cmdPrefix+"logout[::-]  = Remove login data from computer")
 	fmt.Fprintln(textView, "[::b] "+cmdPrefix+"reset[::-]  = Remove stored session and reconnect cleanly")
+	fmt.Fprintln(textView, "[::b] "+cmdPrefix+"account[::-] [name[]  = List accounts or switch to another account")
 	fmt.Fprintln(textView, "[::b] "+cmdPrefix+"quit [::-]or[::b]", config.Config.Keymap.CommandQuit, "[::-] = Exit app")
 	fmt.Fprintln(textView, "")
 	fmt.Fprintln(textView, "[-::-]Chat[-::-]")
 	fmt.Fprintln(textView, "[::b] "+cmdPrefix+"backlog [::-]or[::b]", config.Config.Keymap.CommandBacklog, "[::-] = load next", config.Config.General.BacklogMsgQuantity, "previous messages")
 	fmt.Fprintln(textView, "[::b] "+cmdPrefix+"read [::-]or[::b]", config.Config.Keymap.CommandRead, "[::-] = mark new messages in chat as read")
+	fmt.Fprintln(textView, "[::b] "+cmdPrefix+"search[::-] text  = Search messages in all chats")
+	fmt.Fprintln(textView, "[::b] "+cmdPrefix+"whois[::-] [chat-id|number|name[]  = Details about the current or given contact or group")
+	fmt.Fprintln(textView, "[::b] "+cmdPrefix+"export[::-] format [/path/to/file[] [--media[]  = Export chat as json, markdown, html or txt")
+	fmt.Fprintln(textView, "[::b] "+cmdPrefix+"import[::-] /path/to/export.zip  = Import a chat exported with the phone app")
+	fmt.Fprintln(textView, "[::b] "+cmdPrefix+"reply[::-] [message-id[] text  = Reply to a message")
+	fmt.Fprintln(textView, "[::b] "+cmdPrefix+"edit[::-] [message-id[] text  = Edit own message")
+	fmt.Fprintln(textView, "[::b] "+cmdPrefix+"react[::-] [message-id[] emoji  = React to a message, no emoji removes it")
+	fmt.Fprintln(textView, "[::b] "+cmdPrefix+"outbox[::-] [list|retry|cancel[] [message-id[]  = Show, retry or cancel unsent messages")
 	fmt.Fprintln(textView, "[::b] "+cmdPrefix+"upload[::-] /path/to/file  = Upload any file as document")
 	fmt.Fprintln(textView, "[::b] "+cmdPrefix+"sendimage[::-] /path/to/file  = Send image message")
 	fmt.Fprintln(textView, "[::b] "+cmdPrefix+"sendvideo[::-] /path/to/file  = Send video message")
 	fmt.Fprintln(textView, "[::b] "+cmdPrefix+"sendaudio[::-] /path/to/file  = Send audio message")
+	fmt.Fprintln(textView, "[::b] "+cmdPrefix+"sendcontact[::-] [user-id|number|name|/path/to/card.vcf[]  = Share contact card")
+	fmt.Fprintln(textView, "[::b] "+cmdPrefix+"sendlocation[::-] latitude longitude [name[]  = Send location")
+	fmt.Fprintln(textView, "[::b] "+cmdPrefix+"sendsticker[::-] /path/to/image  = Send image as sticker")
+	fmt.Fprintln(textView, "[::b] "+cmdPrefix+"voice[::-] [/path/to/file|cancel[]  = Record voice note, again to send it, or send a file as voice note")
+	fmt.Fprintln(textView, "[::b] "+cmdPrefix+"play[::-] [message-id[]  = Play voice note or audio message, no id stops playing")
+	fmt.Fprintln(textView, "[::b] "+cmdPrefix+"poll[::-] \"Question\" option | option  = Create a poll")
+	fmt.Fprintln(textView, "[::b] "+cmdPrefix+"vote[::-] [message-id[] [number…[]  = Vote on a poll with option numbers, no number removes the vote")
 	fmt.Fprintln(textView, "")
 	fmt.Fprintln(textView, "[-::-]Groups[-::-]")
 	fmt.Fprintln(textView, "[::b] "+cmdPrefix+"leave[::-]  = Leave group")
 	fmt.Fprintln(textView, "[::b] "+cmdPrefix+"create[::-] [user-id[] [user-id[] Group Subject  = Create group with users")
 	fmt.Fprintln(textView, "[::b] "+cmdPrefix+"subject[::-] New Subject  = Change subject of group")
+	fmt.Fprintln(textView, "[::b] "+cmdPrefix+"description[::-] [text[]  = Change description of group, no text clears it")
+	fmt.Fprintln(textView, "[::b] "+cmdPrefix+"announce[::-] on|off  = Only admins send messages")
+	fmt.Fprintln(textView, "[::b] "+cmdPrefix+"locked[::-] on|off  = Only admins edit group info")
+	fmt.Fprintln(textView, "[::b] "+cmdPrefix+"approval[::-] on|off  = Admins approve new members")
+	fmt.Fprintln(textView, "[::b] "+cmdPrefix+"disappearing[::-] off|24h|7d|90d  = Set disappearing messages timer")
+	fmt.Fprintln(textView, "[::b] "+cmdPrefix+"invitelink[::-] [--reset[]  = Show invite link of group, --reset revokes the old one")
+	fmt.Fprintln(textView, "[::b] "+cmdPrefix+"join[::-] invite-link  = Show the group of an invite link or code, then "+cmdPrefix+"join joins it")
 	fmt.Fprintln(textView, "[::b] "+cmdPrefix+"add[::-] [user-id[]  = Add user to group")
 	fmt.Fprintln(textView, "[::b] "+cmdPrefix+"remove[::-] [user-id[]  = Remove user from group")
 	fmt.Fprintln(textView, "[::b] "+cmdPrefix+"admin[::-] [user-id[]  = Set admin role for user in group")
@@ -481,10 +845,19 @@ func EnterCommand(key tcell.Key) {
 		return
 	}
 	if sndTxt == cmdPrefix+"quit" {
-		sessionManager.CommandChannel <- messages.Command{"disconnect", nil}
+		disconnectAccounts()
 		app.Stop()
 		return
 	}
+	if sndTxt == cmdPrefix+"account" || strings.HasPrefix(sndTxt, cmdPrefix+"account ") {
+		if name := strings.TrimSpace(strings.TrimPrefix(sndTxt, cmdPrefix+"account")); name != "" {
+			SwitchAccount(name)
+		} else {
+			PrintAccounts()
+		}
+		textInput.SetText("")
+		return
+	}
 	if strings.HasPrefix(sndTxt, cmdPrefix) {
 		cmd := strings.TrimPrefix(sndTxt, cmdPrefix)
 		var params []string
@@ -583,9 +956,35 @@ func PrintImage(path string) {
 	PrintError(err)
 }
 
+// updates the top bar, shows the typing or online state of the current chat
+func UpdateTopBar(chatPresence string) {
+	out := "[::b] WhatsCLI " + VERSION + "  [-::d]Type " + config.Config.General.CmdPrefix + "help or press " + config.Config.Keymap.CommandHelp + " for help[-::-]"
+	if chatPresence != "" && currentReceiver.Id != "" {
+		out += "  [" + config.Config.Colors.Positive + "::b]" + tview.Escape(currentReceiver.Name) + "[-::-] " + chatPresence
+	}
+	topBar.SetText(out)
+}
+
+// sends our typing state to the current chat while a message is typed
+func updateTyping(text string) {
+	if !config.Config.General.SharePresence {
+		return
+	}
+	typing := currentReceiver.Id != "" && text != "" && !strings.HasPrefix(text, config.Config.General.CmdPrefix)
+	if typingChat != "" && (!typing || typingChat != currentReceiver.Id) {
+		sessionManager.CommandChannel <- messages.Command{"typing", []string{typingChat, "paused"}}
+		typingChat = ""
+	}
+	if typing && (typingChat == "" || time.Since(typingSent) > 10*time.Second) {
+		sessionManager.CommandChannel <- messages.Command{"typing", []string{currentReceiver.Id, "composing"}}
+		typingChat = currentReceiver.Id
+		typingSent = time.Now()
+	}
+}
+
 // updates the status bar
 func UpdateStatusBar(statusInfo messages.SessionStatus) {
-	out := " "
+	out := " " + getAccountsString()
 	if statusInfo.Connected {
 		out += "[" + config.Config.Colors.Positive + "]online[-]"
 	} else {
@@ -620,6 +1019,16 @@ func SetDisplayedChat(wid messages.Chat) {
 	sessionManager.CommandChannel <- messages.Command{"select", []string{currentReceiver.Id}}
 }
 
+// finds a chat by id in the chat list
+func getChat(id string) messages.Chat {
+	for _, chat := range curChats {
+		if chat.Id == id {
+			return chat
+		}
+	}
+	return messages.Chat{Id: id, IsGroup: strings.HasSuffix(id, messages.GROUPSUFFIX)}
+}
+
 // get a string representation of all messages for chat
 func getMessagesString(msgs []messages.Message) string {
 	out := ""
@@ -635,42 +1044,189 @@ func getMessagesString(msgs []messages.Message) string {
 func getTextMessageString(msg *messages.Message) string {
 	colorMe := config.Config.Colors.ChatMe
 	colorContact := config.Config.Colors.ChatContact
+	if msg.Kind == messages.MessageKindSystem {
+		tim := time.Unix(int64(msg.Timestamp), 0)
+		return "[\"" + msg.Id + "\"][-::d](" + tim.Format("02-01-06 15:04:05") + ") — " + tview.Escape(msg.Text) + "[-::-][\"\"]"
+	}
 	out := ""
-	text := tview.Escape(msg.Text)
+	text := getMentionText(msg)
 	if msg.Forwarded {
 		text = "[" + config.Config.Colors.ForwardedText + "]" + text + "[-]"
 	}
+	if len(msg.Edits) > 0 {
+		text += " [-::d](edited)[-::-]"
+	}
+	if msg.SendFailed {
+		text += " [" + config.Config.Colors.Negative + "::d](not sent)[-::-]"
+	} else if msg.Pending {
+		text += " [-::d](pending)[-::-]"
+	} else if msg.FromMe && !msg.Imported {
+		text += " " + getReceiptString(msg.ReceiptState())
+	}
 	tim := time.Unix(int64(msg.Timestamp), 0)
 	time := tim.Format("02-01-06 15:04:05")
 	out += "[\""
 	out += msg.Id
 	out += "\"]"
+	if msg.QuotedId != "" {
+		out += "[-::d]  ┃ " + tview.Escape(msg.QuotedName) + ": " + tview.Escape(messages.SearchSnippet(msg.QuotedText, "", 60)) + "[-::-]\n"
+	}
 	if msg.FromMe { //msg from me
 		out += "[-::d](" + time + ") [" + colorMe + "::b]Me: [-::-]" + text
 	} else { // message from others
 		out += "[-::d](" + time + ") [" + colorContact + "::b]" + msg.ContactShort + ": [-::-]" + text
 	}
+	if msg.Kind == messages.MessageKindPoll {
+		out += getPollString(msg)
+	}
+	if len(msg.Reactions) > 0 {
+		out += "\n[-::d]  " + getReactionsString(msg.Reactions) + "[-::-]"
+	}
 	out += "[\"\"]"
 	return out
 }
 
-type UiHandler struct{}
+// a mention in the text of a message, @ and the user part of the id
+var mentionNumberPattern = regexp.MustCompile(`@(\d+)\b`)
+
+// escapes the text of a message and shows mentions as highlighted names,
+// mentions of ourselves are shown reversed
+func getMentionText(msg *messages.Message) string {
+	text := tview.Escape(msg.Text)
+	if len(msg.Mentions) == 0 {
+		return text
+	}
+	mentions := make(map[string]messages.Mention, len(msg.Mentions))
+	for _, mention := range msg.Mentions {
+		mentions[strings.SplitN(mention.Id, "@", 2)[0]] = mention
+	}
+	return mentionNumberPattern.ReplaceAllStringFunc(text, func(match string) string {
+		mention, ok := mentions[match[1:]]
+		if !ok {
+			return match
+		}
+		style := "::b"
+		if mention.Name == "Me" {
+			style = "::rb"
+		}
+		return "[" + config.Config.Colors.Mention + style + "]@" + tview.Escape(mention.Name) + "[-::-]"
+	})
+}
+
+// shows the receipt state of an own message as ticks
+func getReceiptString(state messages.ReceiptState) string {
+	switch state {
+	case messages.ReceiptDelivered:
+		return "[-::d]✓✓[-::-]"
+	case messages.ReceiptRead:
+		return "[" + config.Config.Colors.ReadReceipt + "]✓✓[-]"
+	case messages.ReceiptPlayed:
+		return "[" + config.Config.Colors.ReadReceipt + "]✓✓▶[-]"
+	default:
+		return "[-::d]✓[-::-]"
+	}
+}
+
+// lists the options of a poll with their number and votes, our own choices
+// are marked
+func getPollString(msg *messages.Message) string {
+	options := messages.PollResults(*msg)
+	most := 0
+	for _, option := range options {
+		if option.Votes > most {
+			most = option.Votes
+		}
+	}
+	out := ""
+	for idx, option := range options {
+		mark := " "
+		if option.Mine {
+			mark = "[" + config.Config.Colors.Positive + "]✓[-]"
+		}
+		// bars are at most 10 blocks wide
+		bar := 0
+		if most > 0 {
+			bar = (option.Votes*10 + most - 1) / most
+		}
+		out += fmt.Sprintf("\n  %s [-::d]%d.[-::-] %s [-::d]%s %d[-::-]", mark, idx+1, tview.Escape(option.Name), strings.Repeat("▇", bar), option.Votes)
+	}
+	return out
+}
+
+// summarizes reactions as emojis with their count, in order of first use
+func getReactionsString(reactions []messages.Reaction) string {
+	counts := make(map[string]int)
+	order := make([]string, 0)
+	for _, reaction := range reactions {
+		if counts[reaction.Emoji] == 0 {
+			order = append(order, reaction.Emoji)
+		}
+		counts[reaction.Emoji]++
+	}
+	parts := make([]string, 0, len(order))
+	for _, emoji := range order {
+		part := tview.Escape(emoji)
+		if counts[emoji] > 1 {
+			part += " " + fmt.Sprint(counts[emoji])
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "  ")
+}
+
+// create a formatted string with regions based on message ID for a search result
+func getSearchResultString(msg *messages.Message, query string) string {
+	chatName := getChat(msg.ChatId).Name
+	if chatName == "" {
+		chatName = strings.TrimSuffix(strings.TrimSuffix(msg.ChatId, messages.GROUPSUFFIX), messages.CONTACTSUFFIX)
+	}
+	sender := msg.ContactShort
+	if msg.FromMe {
+		sender = "Me"
+	}
+	tim := time.Unix(int64(msg.Timestamp), 0)
+	return "[\"" + msg.Id + "\"][-::d](" + tim.Format("02-01-06 15:04:05") + ") " +
+		"[" + config.Config.Colors.ListHeader + "::b]" + tview.Escape(chatName) + "[-::-] " +
+		"[" + config.Config.Colors.ChatContact + "::b]" + tview.Escape(sender) + ": [-::-]" +
+		tview.Escape(messages.SearchSnippet(msg.Text, query, 80)) + "[\"\"]"
+}
+
+// shows the output of the session of an account, output of accounts that
+// are not shown is dropped or marked with the account name
+type UiHandler struct {
+	account string
+}
+
+// returns true if the account of the handler is the one shown
+func (u UiHandler) active() bool {
+	return activeAccount.Load() == u.account
+}
 
 func (u UiHandler) NewMessage(msg messages.Message) {
+	if !u.active() {
+		return
+	}
 	//TODO: its stupid to "go" this as its supposed to run
 	//on the ui thread anyway. But QueueUpdate blocks...?
 	go app.QueueUpdateDraw(func() {
+		if showingSearch {
+			return
+		}
 		curRegions = append(curRegions, msg)
 		PrintText(getTextMessageString(&msg))
 	})
 }
 
 func (u UiHandler) NewScreen(msgs []messages.Message) {
+	if !u.active() {
+		return
+	}
 	go app.QueueUpdateDraw(func() {
 		textView.Clear()
 		screen := getMessagesString(msgs)
 		textView.SetText(screen)
 		curRegions = msgs
+		showingSearch = false
 		if screen == "" {
 			if currentReceiver.Id == "" {
 				PrintHelp()
@@ -678,28 +1234,66 @@ func (u UiHandler) NewScreen(msgs []messages.Message) {
 				PrintText("[::d] ~~~ no messages, press " + config.Config.Keymap.CommandBacklog + " to load backlog if available ~~~[::-]")
 			}
 		}
+		if jumpHighlight != "" {
+			textView.Highlight(jumpHighlight)
+			textView.ScrollToHighlight()
+			app.SetFocus(textView)
+			jumpHighlight = ""
+		}
 	})
 }
 
+func (u UiHandler) SearchResults(query string, msgs []messages.Message) {
+	if !u.active() {
+		return
+	}
+	go app.QueueUpdateDraw(func() {
+		textView.Clear()
+		fmt.Fprintln(textView, "[-::u]Search results for \""+tview.Escape(query)+"\":[-::-]")
+		fmt.Fprintln(textView, "")
+		for idx := len(msgs) - 1; idx >= 0; idx-- {
+			fmt.Fprintln(textView, getSearchResultString(&msgs[idx], query))
+		}
+		fmt.Fprintln(textView, "")
+		fmt.Fprintln(textView, "[::d] ~~~ press "+config.Config.Keymap.FocusMessages+" to select a message and "+config.Config.Keymap.MessageJump+" to jump to it ~~~[::-]")
+		reversed := make([]messages.Message, len(msgs))
+		for idx, msg := range msgs {
+			reversed[len(msgs)-1-idx] = msg
+		}
+		curRegions = reversed
+		showingSearch = true
+		textView.ScrollToEnd()
+	})
+}
+
+// creates the name of a chat shown in lists, with the count of unread messages
+func getChatListName(chat messages.Chat) string {
+	name := chat.Name
+	if name == "" {
+		name = strings.TrimSuffix(strings.TrimSuffix(chat.Id, messages.GROUPSUFFIX), messages.CONTACTSUFFIX)
+	}
+	if chat.Unread > 0 {
+		name += " ([" + config.Config.Colors.UnreadCount + "]" + fmt.Sprint(chat.Unread) + "[-])"
+	}
+	if chat.Mentioned {
+		name += " [" + config.Config.Colors.Mention + "::b]@[-::-]"
+	}
+	return name
+}
+
 // loads the chat data from storage to the TreeView
 func (u UiHandler) SetChats(ids []messages.Chat) {
 	go app.QueueUpdateDraw(func() {
+		setAccountUnread(u.account, ids)
+		if !u.active() {
+			UpdateStatusBar(accountStates[config.GetAccount()].status)
+			return
+		}
+		curChats = ids
 		chatRoot.ClearChildren()
 		oldId := currentReceiver.Id
 		for _, element := range ids {
-			name := element.Name
-			if name == "" {
-				name = strings.TrimSuffix(strings.TrimSuffix(element.Id, messages.GROUPSUFFIX), messages.CONTACTSUFFIX)
-			}
-			if element.Unread > 0 {
-				name += " ([" + config.Config.Colors.UnreadCount + "]" + fmt.Sprint(element.Unread) + "[-])"
-				//tim := time.Unix(element.LastMessage, 0)
-				//sin := time.Since(tim)
-				//since := fmt.Sprintf("%s", sin)
-				//time := tim.Format("02-01-06 15:04:05")
-				//name += since
-			}
-			node := tview.NewTreeNode(name).
+			node := tview.NewTreeNode(getChatListName(element)).
 				SetReference(element).
 				SetSelectable(true)
 			if element.IsGroup {
@@ -709,6 +1303,9 @@ func (u UiHandler) SetChats(ids []messages.Chat) {
 			}
 			// store new currentReceiver, else the selection on the left goes off
 			if element.Id == oldId {
+				if element.Name != currentReceiver.Name {
+					textView.SetTitle(element.Name)
+				}
 				currentReceiver = element
 			}
 			chatRoot.AddChild(node)
@@ -720,14 +1317,23 @@ func (u UiHandler) SetChats(ids []messages.Chat) {
 }
 
 func (u UiHandler) PrintError(err error) {
+	if err != nil && !u.active() {
+		err = fmt.Errorf("%s %v", tview.Escape("["+u.account+"]"), err)
+	}
 	PrintError(err)
 }
 
 func (u UiHandler) PrintText(msg string) {
+	if !u.active() {
+		msg = "[::d]" + tview.Escape("["+u.account+"]") + "[::-] " + msg
+	}
 	PrintText(msg)
 }
 
 func (u UiHandler) PrintFile(path string) {
+	if !u.active() {
+		return
+	}
 	go app.QueueUpdateDraw(func() {
 		PrintImage(path)
 	})
@@ -739,7 +1345,14 @@ func (u UiHandler) OpenFile(path string) {
 
 func (u UiHandler) SetStatus(status messages.SessionStatus) {
 	go app.QueueUpdateDraw(func() {
+		state := accountStates[u.account]
+		state.status = status
+		accountStates[u.account] = state
+		if !u.active() {
+			return
+		}
 		UpdateStatusBar(status)
+		UpdateTopBar(status.ChatPresence)
 	})
 }
 
@@ -0,0 +1,175 @@
+package messages
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/normen/whatscli/config"
+)
+
+// maximum number of completion candidates offered at once
+const completionLimit = 20
+
+// commands handled by the UI itself, the others go to the session manager
+var uiCommands = []string{"account", "commands", "help", "quit"}
+
+// CommandNames returns the commands that can be entered after the command
+// prefix, including the ones handled by the UI itself, sorted.
+func CommandNames() []string {
+	names := append(Commands(), uiCommands...)
+	sort.Strings(names)
+	return names
+}
+
+// commands that take user ids as parameters
+var userCommands = map[string]bool{
+	"add": true, "remove": true, "admin": true, "removeadmin": true, "create": true,
+}
+
+// commands that take a file path as parameter
+var pathCommands = map[string]bool{
+	"upload": true, "sendimage": true, "sendvideo": true, "sendaudio": true, "sendsticker": true, "sendcontact": true, "voice": true, "import": true,
+}
+
+// Completion is a candidate to complete the text of the input field.
+type Completion struct {
+	// the complete input text after choosing the candidate
+	Text string
+	// the candidate as shown in the list
+	Display string
+}
+
+// Complete returns the candidates to complete the end of the input text. It
+// completes command names, user ids for group commands, file paths for
+// commands that send files and @mentions in group chats.
+func (sm *SessionManager) Complete(text, chatID string) []Completion {
+	cmdPrefix := config.Config.General.CmdPrefix
+	if strings.HasPrefix(text, cmdPrefix) {
+		cmd := strings.TrimPrefix(text, cmdPrefix)
+		space := strings.Index(cmd, " ")
+		if space < 0 {
+			return completeCommand(cmdPrefix, cmd)
+		}
+		name, params := cmd[:space], cmd[space+1:]
+		before := cmdPrefix + name + " "
+		switch {
+		case userCommands[name]:
+			words := strings.Split(params, " ")
+			before += strings.Join(words[:len(words)-1], " ")
+			if len(words) > 1 {
+				before += " "
+			}
+			return sm.completeUser(before, words[len(words)-1])
+		case pathCommands[name]:
+			return completePath(before, params)
+		}
+	}
+	if !strings.HasSuffix(chatID, GROUPSUFFIX) {
+		return nil
+	}
+	at := strings.LastIndex(text, "@")
+	if at < 0 || strings.Contains(text[at:], " ") || at > 0 && text[at-1] != ' ' {
+		return nil
+	}
+	return sm.completeMention(chatID, text[:at], text[at+1:])
+}
+
+func completeCommand(cmdPrefix, partial string) []Completion {
+	out := make([]Completion, 0)
+	for _, name := range CommandNames() {
+		if strings.HasPrefix(name, partial) {
+			out = append(out, Completion{Text: cmdPrefix + name + " ", Display: cmdPrefix + name})
+		}
+	}
+	return out
+}
+
+// completeUser completes a word with the ids of contacts matching its name or number
+func (sm *SessionManager) completeUser(before, word string) []Completion {
+	out := make([]Completion, 0)
+	for _, chat := range sm.db.FuzzyChats(word, 0) {
+		if chat.IsGroup || !strings.HasSuffix(chat.Id, CONTACTSUFFIX) {
+			continue
+		}
+		out = append(out, Completion{Text: before + chat.Id + " ", Display: chat.Name + " (" + chat.Id + ")"})
+		if len(out) == completionLimit {
+			break
+		}
+	}
+	return out
+}
+
+// completeMention completes an @mention with the number of a group member
+func (sm *SessionManager) completeMention(chatID, before, word string) []Completion {
+	type ranked struct {
+		id    string
+		name  string
+		score int
+	}
+	matches := make([]ranked, 0)
+	for _, id := range sm.db.GetGroupMembers(chatID) {
+		name := sm.db.GetIdName(id)
+		score := fuzzyScore(name, word)
+		if numberScore := fuzzyScore(jidUser(id), word); numberScore > score {
+			score = numberScore
+		}
+		if score >= 0 {
+			matches = append(matches, ranked{id, name, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return strings.ToLower(matches[i].name) < strings.ToLower(matches[j].name)
+	})
+	out := make([]Completion, 0, len(matches))
+	for _, match := range matches {
+		number := jidUser(match.id)
+		out = append(out, Completion{Text: before + "@" + number + " ", Display: match.name + " (@" + number + ")"})
+		if len(out) == completionLimit {
+			break
+		}
+	}
+	return out
+}
+
+// completePath completes a file path, directories end with a separator so
+// the completion can continue inside them
+func completePath(before, path string) []Completion {
+	if strings.HasPrefix(path, "~"+string(os.PathSeparator)) || path == "~" {
+		path = config.GetHomeDir() + strings.TrimPrefix(strings.TrimPrefix(path, "~"), string(os.PathSeparator))
+	}
+	dir, base := filepath.Split(path)
+	listDir := dir
+	if listDir == "" {
+		listDir = "."
+	}
+	entries, err := os.ReadDir(listDir)
+	if err != nil {
+		return nil
+	}
+	out := make([]Completion, 0)
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, base) || strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".") {
+			continue
+		}
+		isDir := entry.IsDir()
+		if entry.Type()&os.ModeSymlink != 0 {
+			if info, err := os.Stat(filepath.Join(listDir, name)); err == nil {
+				isDir = info.IsDir()
+			}
+		}
+		if isDir {
+			name += string(os.PathSeparator)
+		}
+		out = append(out, Completion{Text: before + dir + name, Display: name})
+		if len(out) == completionLimit {
+			break
+		}
+	}
+	return out
+}
@@ -0,0 +1,75 @@
+package messages
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompleteCommandsAndUsers(t *testing.T) {
+	sm := &SessionManager{}
+	sm.Init(nil)
+	sm.db.AddContact(Contact{Id: "111@s.whatsapp.net", Name: "Alice", Short: "Alice"})
+	sm.db.AddContact(Contact{Id: "222@s.whatsapp.net", Name: "Bob", Short: "Bob"})
+
+	candidates := sm.Complete("/send", "")
+	if len(candidates) != 7 || candidates[0].Text != "/send " || candidates[1].Text != "/sendaudio " {
+		t.Fatalf("unexpected command completions: %#v", candidates)
+	}
+	candidates = sm.Complete("/create 222@s.whatsapp.net ali", "")
+	if len(candidates) != 1 || candidates[0].Text != "/create 222@s.whatsapp.net 111@s.whatsapp.net " {
+		t.Fatalf("unexpected user completions: %#v", candidates)
+	}
+	if candidates = sm.Complete("hello ali", ""); len(candidates) != 0 {
+		t.Fatalf("expected no completion for plain text: %#v", candidates)
+	}
+}
+
+func TestCommandNamesCoverAllCommands(t *testing.T) {
+	names := make(map[string]bool)
+	for _, name := range CommandNames() {
+		names[name] = true
+	}
+	for _, name := range append(Commands(), "help", "quit", "account", "commands") {
+		if !names[name] {
+			t.Fatalf("command %s is not completed", name)
+		}
+	}
+}
+
+func TestCompleteMention(t *testing.T) {
+	sm := &SessionManager{}
+	sm.Init(nil)
+	group := "333@g.us"
+	sm.db.AddContact(Contact{Id: "111@s.whatsapp.net", Name: "Alice", Short: "Alice"})
+	sm.db.AddMessage(Message{Id: "1", ChatId: group, SenderId: "111@s.whatsapp.net", Timestamp: 1, Text: "hi"}, false)
+	sm.db.AddMessage(Message{Id: "2", ChatId: group, SenderId: "me@s.whatsapp.net", FromMe: true, Timestamp: 2, Text: "ho"}, false)
+
+	candidates := sm.Complete("hey @al", group)
+	if len(candidates) != 1 || candidates[0].Text != "hey @111 " || candidates[0].Display != "Alice (@111)" {
+		t.Fatalf("unexpected mention completions: %#v", candidates)
+	}
+	if candidates = sm.Complete("mail@al", group); len(candidates) != 0 {
+		t.Fatalf("expected no mention inside a word: %#v", candidates)
+	}
+	if candidates = sm.Complete("hey @al", "111@s.whatsapp.net"); len(candidates) != 0 {
+		t.Fatalf("expected no mentions outside of groups: %#v", candidates)
+	}
+}
+
+func TestCompletePath(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "photos"), 0755)
+	os.WriteFile(filepath.Join(dir, "photo.jpg"), nil, 0644)
+	os.WriteFile(filepath.Join(dir, ".hidden"), nil, 0644)
+	sm := &SessionManager{}
+	sm.Init(nil)
+
+	candidates := sm.Complete("/sendimage "+dir+"/pho", "")
+	if len(candidates) != 2 || candidates[0].Text != "/sendimage "+dir+"/photo.jpg" || candidates[1].Display != "photos/" {
+		t.Fatalf("unexpected path completions: %#v", candidates)
+	}
+	if candidates = sm.Complete("/upload "+dir+"/", ""); len(candidates) != 2 {
+		t.Fatalf("expected hidden files to be skipped: %#v", candidates)
+	}
+}
@@ -0,0 +1,246 @@
+package messages
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+// a contact shared as vCard
+type vCard struct {
+	Name   string
+	Phones []vCardPhone
+}
+
+// a phone number of a vCard, WaId is the WhatsApp user of the number if known
+type vCardPhone struct {
+	Number string
+	WaId   string
+}
+
+// parseVCard reads the name and phone numbers of a vCard
+func parseVCard(text string) vCard {
+	card := vCard{}
+	structuredName := ""
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	// folded lines continue with a space or tab
+	text = strings.ReplaceAll(strings.ReplaceAll(text, "\n ", ""), "\n\t", "")
+	for _, line := range strings.Split(text, "\n") {
+		colon := strings.Index(line, ":")
+		if colon < 0 {
+			continue
+		}
+		params := strings.Split(line[:colon], ";")
+		name := strings.ToUpper(params[0])
+		if dot := strings.LastIndex(name, "."); dot >= 0 {
+			name = name[dot+1:]
+		}
+		value := vCardUnescape(line[colon+1:])
+		switch name {
+		case "FN":
+			card.Name = value
+		case "N":
+			parts := strings.Split(line[colon+1:], ";")
+			if len(parts) > 1 {
+				structuredName = strings.TrimSpace(vCardUnescape(parts[1]) + " " + vCardUnescape(parts[0]))
+			} else {
+				structuredName = value
+			}
+		case "TEL":
+			phone := vCardPhone{Number: strings.TrimSpace(value)}
+			for _, param := range params[1:] {
+				if key, waID, ok := strings.Cut(param, "="); ok && strings.EqualFold(key, "waid") {
+					phone.WaId = waID
+				}
+			}
+			card.Phones = append(card.Phones, phone)
+		}
+	}
+	if card.Name == "" {
+		card.Name = structuredName
+	}
+	return card
+}
+
+func vCardUnescape(value string) string {
+	return strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(value)
+}
+
+// contactCards returns the vCards of a contact message, shared contacts can
+// hold several
+func contactCards(raw *waProto.Message) []string {
+	if contact := raw.GetContactMessage(); contact != nil {
+		return []string{contact.GetVcard()}
+	}
+	cards := make([]string, 0)
+	for _, contact := range raw.GetContactsArrayMessage().GetContacts() {
+		cards = append(cards, contact.GetVcard())
+	}
+	return cards
+}
+
+// contactCardText shows the names and phone numbers of shared contacts
+func contactCardText(raw *waProto.Message) string {
+	cards := contactCards(raw)
+	label := "[CONTACT]"
+	if len(cards) > 1 {
+		label = "[CONTACTS]"
+	}
+	parts := make([]string, 0, len(cards))
+	for idx, text := range cards {
+		card := parseVCard(text)
+		if card.Name == "" {
+			if contact := raw.GetContactMessage(); contact != nil {
+				card.Name = contact.GetDisplayName()
+			} else {
+				card.Name = raw.GetContactsArrayMessage().GetContacts()[idx].GetDisplayName()
+			}
+		}
+		numbers := make([]string, 0, len(card.Phones))
+		for _, phone := range card.Phones {
+			numbers = append(numbers, phone.Number)
+		}
+		part := card.Name
+		if len(numbers) > 0 {
+			part += ": " + strings.Join(numbers, ", ")
+		}
+		parts = append(parts, part)
+	}
+	return label + " " + strings.Join(parts, "; ")
+}
+
+// ContactCardChat returns the chat with the first contact of a shared contact
+// message that has a phone number.
+func ContactCardChat(msg Message) (Chat, error) {
+	if msg.Kind != MessageKindContact {
+		return Chat{}, errors.New("this is not a contact message")
+	}
+	for _, text := range contactCards(msg.RawMessage) {
+		card := parseVCard(text)
+		for _, phone := range card.Phones {
+			user := phone.WaId
+			if user == "" {
+				user = strings.Map(func(r rune) rune {
+					if unicode.IsDigit(r) {
+						return r
+					}
+					return -1
+				}, phone.Number)
+			}
+			if user != "" {
+				return Chat{Id: user + CONTACTSUFFIX, Name: card.Name}, nil
+			}
+		}
+	}
+	return Chat{}, errors.New("the contact has no phone number")
+}
+
+// saveContactCard writes the vCards of a contact message to a .vcf file
+func saveContactCard(msg Message, baseDir string) (string, error) {
+	cards := contactCards(msg.RawMessage)
+	if len(cards) == 0 {
+		return "", errors.New("the message has no contact card")
+	}
+	if err := os.MkdirAll(baseDir, 0o755); err != nil {
+		return "", err
+	}
+	name := parseVCard(cards[0]).Name
+	if name == "" || len(cards) > 1 {
+		name = msg.Id
+	}
+	fullPath := filepath.Join(baseDir, safeFileName(name)+".vcf")
+	data := ""
+	for _, card := range cards {
+		data += strings.TrimRight(card, "\r\n") + "\n"
+	}
+	return fullPath, os.WriteFile(fullPath, []byte(data), 0o644)
+}
+
+// sendContactCommand shares a contact card from a .vcf file or of a
+// WhatsApp contact with the current chat
+func (sm *SessionManager) sendContactCommand(params []string) {
+	if sm.currentReceiver == "" {
+		sm.printCommandUsage("sendcontact", "-> only works in a chat")
+		return
+	}
+	if !checkParam(params, 1) {
+		sm.printCommandUsage("sendcontact", "[user-id|number|name|/path/to/card.vcf[]")
+		return
+	}
+	query := strings.Join(params, " ")
+	var cards []string
+	if data, err := os.ReadFile(query); err == nil {
+		cards = splitVCards(string(data))
+	} else {
+		chatID, err := sm.db.FindChat(query)
+		if err != nil {
+			sm.uiHandler.PrintError(err)
+			return
+		}
+		if !strings.HasSuffix(chatID, CONTACTSUFFIX) {
+			sm.uiHandler.PrintError(errors.New("only contacts can be shared"))
+			return
+		}
+		cards = []string{buildVCard(sm.db.GetIdName(chatID), jidUser(chatID))}
+	}
+	if len(cards) == 0 {
+		sm.uiHandler.PrintError(errors.New("no contact card found in file"))
+		return
+	}
+	raw := &waProto.Message{}
+	if len(cards) == 1 {
+		raw.ContactMessage = &waProto.ContactMessage{
+			DisplayName: proto.String(parseVCard(cards[0]).Name),
+			Vcard:       proto.String(cards[0]),
+		}
+	} else {
+		contacts := make([]*waProto.ContactMessage, 0, len(cards))
+		for _, card := range cards {
+			contacts = append(contacts, &waProto.ContactMessage{
+				DisplayName: proto.String(parseVCard(card).Name),
+				Vcard:       proto.String(card),
+			})
+		}
+		raw.ContactsArrayMessage = &waProto.ContactsArrayMessage{
+			DisplayName: proto.String(fmt.Sprintf("%d contacts", len(cards))),
+			Contacts:    contacts,
+		}
+	}
+	sm.uiHandler.PrintError(sm.sendOrQueue(OutboxEntry{
+		ChatId: sm.currentReceiver,
+		Kind:   MessageKindContact,
+		Text:   contactCardText(raw),
+		Raw:    raw,
+	}))
+}
+
+// buildVCard creates the vCard of a WhatsApp user the way the phone app does
+func buildVCard(name, number string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, ",", `\,`, ";", `\;`).Replace(name)
+	return "BEGIN:VCARD\nVERSION:3.0\nN:;" + escaped + ";;;\nFN:" + escaped +
+		"\nTEL;type=CELL;type=VOICE;waid=" + number + ":+" + number + "\nEND:VCARD"
+}
+
+// splitVCards returns the single vCards of a .vcf file
+func splitVCards(text string) []string {
+	cards := make([]string, 0)
+	current := ""
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		switch {
+		case strings.EqualFold(strings.TrimSpace(line), "BEGIN:VCARD"):
+			current = line + "\n"
+		case strings.EqualFold(strings.TrimSpace(line), "END:VCARD") && current != "":
+			cards = append(cards, current+line)
+			current = ""
+		case current != "":
+			current += line + "\n"
+		}
+	}
+	return cards
+}
@@ -0,0 +1,72 @@
+package messages
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+const aliceCard = "BEGIN:VCARD\r\nVERSION:3.0\r\nN:Smith;Alice;;;\r\nFN:Alice Smith\r\n" +
+	"item1.TEL;type=CELL;waid=4915112345:+49 151 1234\r\n 5\r\nTEL;type=HOME:+49 30 555\r\nEND:VCARD"
+
+func TestParseVCard(t *testing.T) {
+	card := parseVCard(aliceCard)
+	expected := vCard{Name: "Alice Smith", Phones: []vCardPhone{
+		{Number: "+49 151 12345", WaId: "4915112345"},
+		{Number: "+49 30 555"},
+	}}
+	if !reflect.DeepEqual(card, expected) {
+		t.Fatalf("unexpected card: %#v", card)
+	}
+	if card = parseVCard("BEGIN:VCARD\nN:Doe;John\\, Jr.;;;\nEND:VCARD"); card.Name != "John, Jr. Doe" {
+		t.Fatalf("unexpected name: %q", card.Name)
+	}
+	built := parseVCard(buildVCard("Bob; Builder", "222"))
+	if built.Name != "Bob; Builder" || built.Phones[0].WaId != "222" || built.Phones[0].Number != "+222" {
+		t.Fatalf("unexpected built card: %#v", built)
+	}
+	if cards := splitVCards(aliceCard + "\r\n" + buildVCard("Bob", "222") + "\n"); len(cards) != 2 {
+		t.Fatalf("expected two cards, got %d", len(cards))
+	}
+}
+
+func TestIncomingContactCard(t *testing.T) {
+	sm := &SessionManager{}
+	sm.Init(nil)
+	info := types.MessageInfo{
+		MessageSource: types.MessageSource{Chat: types.NewJID("111", types.DefaultUserServer), Sender: types.NewJID("111", types.DefaultUserServer)},
+		ID:            "m1",
+	}
+	raw := &waProto.Message{ContactsArrayMessage: &waProto.ContactsArrayMessage{
+		Contacts: []*waProto.ContactMessage{
+			{DisplayName: proto.String("Alice"), Vcard: proto.String(aliceCard)},
+			{DisplayName: proto.String("Carol"), Vcard: proto.String("BEGIN:VCARD\nTEL:+1 555\nEND:VCARD")},
+		},
+	}}
+	msg, ok := sm.eventHandler.messageFromInfo(info, raw)
+	if !ok || msg.Kind != MessageKindContact {
+		t.Fatalf("unexpected message: %#v", msg)
+	}
+	if msg.Text != "[CONTACTS] Alice Smith: +49 151 12345, +49 30 555; Carol: +1 555" {
+		t.Fatalf("unexpected text: %q", msg.Text)
+	}
+	chat, err := ContactCardChat(msg)
+	if err != nil || chat.Id != "4915112345"+CONTACTSUFFIX || chat.Name != "Alice Smith" {
+		t.Fatalf("unexpected chat: %#v %v", chat, err)
+	}
+
+	dir := t.TempDir()
+	path, err := sm.downloadMessageTo(msg, dir)
+	if err != nil || filepath.Dir(path) != dir {
+		t.Fatalf("unexpected download: %q %v", path, err)
+	}
+	data, _ := os.ReadFile(path)
+	if cards := splitVCards(string(data)); len(cards) != 2 {
+		t.Fatalf("expected both cards in file, got %q", data)
+	}
+}
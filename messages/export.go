@@ -0,0 +1,259 @@
+package messages
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// file extensions of the supported export formats
+var exportExtensions = map[string]string{
+	"json":     ".jsonl",
+	"markdown": ".md",
+	"html":     ".html",
+	"txt":      ".txt",
+}
+
+// ExportFormats returns the names of the supported export formats.
+func ExportFormats() []string {
+	formats := make([]string, 0, len(exportExtensions))
+	for format := range exportExtensions {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// ChatExport holds the data of a chat archive.
+type ChatExport struct {
+	ChatName string
+	SelfName string
+	Messages []Message
+	// paths of downloaded attachments by message id, relative to the export file
+	Media map[string]string
+}
+
+// a single message in a JSON lines export
+type exportRecord struct {
+	Id        string `json:"id"`
+	Chat      string `json:"chat"`
+	Time      string `json:"time"`
+	Timestamp uint64 `json:"timestamp"`
+	Sender    string `json:"sender"`
+	SenderId  string `json:"sender_id,omitempty"`
+	FromMe    bool   `json:"from_me"`
+	Kind      string `json:"kind"`
+	Text      string `json:"text"`
+	Caption   string `json:"caption,omitempty"`
+	FileName  string `json:"file_name,omitempty"`
+	MimeType  string `json:"mime_type,omitempty"`
+	Media     string `json:"media,omitempty"`
+	QuotedId  string `json:"quoted_id,omitempty"`
+	Forwarded bool   `json:"forwarded,omitempty"`
+	Edited    bool   `json:"edited,omitempty"`
+}
+
+// Write writes the chat in the given format.
+func (e *ChatExport) Write(w io.Writer, format string) error {
+	buf := bufio.NewWriter(w)
+	var err error
+	switch format {
+	case "json":
+		err = e.writeJSON(buf)
+	case "markdown":
+		err = e.writeMarkdown(buf)
+	case "html":
+		err = e.writeHTML(buf)
+	case "txt":
+		err = e.writeText(buf)
+	default:
+		return fmt.Errorf("unknown export format %q, use one of: %s", format, strings.Join(ExportFormats(), ", "))
+	}
+	if err != nil {
+		return err
+	}
+	return buf.Flush()
+}
+
+func (e *ChatExport) sender(msg Message) string {
+	if msg.Kind == MessageKindSystem {
+		return ""
+	}
+	if msg.FromMe {
+		if e.SelfName != "" {
+			return e.SelfName
+		}
+		return "Me"
+	}
+	if msg.ContactName != "" {
+		return msg.ContactName
+	}
+	return msg.ContactShort
+}
+
+// isTextKind returns true for messages that are exported with their text,
+// all others have an attachment
+func isTextKind(kind MessageKind) bool {
+	switch kind {
+	case MessageKindText, MessageKindUnknown, MessageKindSystem, MessageKindLocation, MessageKindContact, MessageKindPoll, "":
+		return true
+	}
+	return false
+}
+
+// body returns the text of a message without the attachment label
+func (e *ChatExport) body(msg Message) string {
+	if isTextKind(msg.Kind) {
+		return msg.Text
+	}
+	return messageCaption(msg.RawMessage)
+}
+
+func (e *ChatExport) writeJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	for _, msg := range e.Messages {
+		record := exportRecord{
+			Id:        msg.Id,
+			Chat:      msg.ChatId,
+			Time:      time.Unix(int64(msg.Timestamp), 0).Format(time.RFC3339),
+			Timestamp: msg.Timestamp,
+			Sender:    e.sender(msg),
+			SenderId:  msg.SenderId,
+			FromMe:    msg.FromMe,
+			Kind:      string(msg.Kind),
+			Text:      msg.Text,
+			FileName:  msg.FileName,
+			MimeType:  msg.MimeType,
+			Media:     e.Media[msg.Id],
+			QuotedId:  msg.QuotedId,
+			Forwarded: msg.Forwarded,
+			Edited:    len(msg.Edits) > 0,
+		}
+		if !isTextKind(msg.Kind) {
+			record.Caption = messageCaption(msg.RawMessage)
+		}
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *ChatExport) writeMarkdown(w io.Writer) error {
+	fmt.Fprintf(w, "# %s\n", e.ChatName)
+	lastDay := ""
+	for _, msg := range e.Messages {
+		tim := time.Unix(int64(msg.Timestamp), 0)
+		if day := tim.Format("2006-01-02"); day != lastDay {
+			fmt.Fprintf(w, "\n## %s\n\n", day)
+			lastDay = day
+		}
+		if msg.Kind == MessageKindSystem {
+			fmt.Fprintf(w, "_%s (%s)_\n\n", msg.Text, tim.Format("15:04"))
+			continue
+		}
+		fmt.Fprintf(w, "**%s** (%s): ", e.sender(msg), tim.Format("15:04"))
+		if media, ok := e.Media[msg.Id]; ok {
+			link := "[" + path.Base(media) + "](" + strings.ReplaceAll(media, " ", "%20") + ")"
+			if msg.Kind == MessageKindImage || msg.Kind == MessageKindSticker {
+				link = "!" + link
+			}
+			fmt.Fprint(w, link)
+			if body := e.body(msg); body != "" {
+				fmt.Fprint(w, " ")
+			}
+			fmt.Fprint(w, strings.ReplaceAll(e.body(msg), "\n", "  \n"))
+		} else {
+			fmt.Fprint(w, strings.ReplaceAll(msg.Text, "\n", "  \n"))
+		}
+		fmt.Fprint(w, "\n\n")
+	}
+	return nil
+}
+
+var exportTemplate = template.Must(template.New("export").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.ChatName}}</title>
+<style>
+body { font-family: sans-serif; background: #ece5dd; margin: 0 auto; max-width: 50em; padding: 1em; }
+.day { text-align: center; color: #555; margin: 1.5em 0 0.5em; }
+.msg { background: #fff; border-radius: 0.5em; padding: 0.4em 0.7em; margin: 0.3em 0; max-width: 80%; white-space: pre-wrap; }
+.me { background: #dcf8c6; margin-left: auto; }
+.sender { font-weight: bold; color: #075e54; }
+.time { color: #999; font-size: 0.8em; float: right; margin-left: 1em; }
+img, video { max-width: 100%; display: block; }
+</style>
+</head>
+<body>
+<h1>{{.ChatName}}</h1>
+{{range .Messages}}{{if .Day}}<div class="day">{{.Day}}</div>
+{{end}}<div class="msg{{if .FromMe}} me{{end}}"><span class="time">{{.Time}}</span><span class="sender">{{.Sender}}</span>
+{{if .Media}}{{if or (eq .Kind "image") (eq .Kind "sticker")}}<img src="{{.Media}}" alt="{{.Media}}">{{else if eq .Kind "video"}}<video src="{{.Media}}" controls></video>{{else if or (eq .Kind "audio") (eq .Kind "voice")}}<audio src="{{.Media}}" controls></audio>{{else}}<a href="{{.Media}}">{{.Media}}</a>{{end}}
+{{end}}{{.Text}}</div>
+{{end}}</body>
+</html>
+`))
+
+func (e *ChatExport) writeHTML(w io.Writer) error {
+	type htmlMessage struct {
+		Day, Time, Sender, Kind, Text, Media string
+		FromMe                               bool
+	}
+	data := struct {
+		ChatName string
+		Messages []htmlMessage
+	}{ChatName: e.ChatName}
+	lastDay := ""
+	for _, msg := range e.Messages {
+		tim := time.Unix(int64(msg.Timestamp), 0)
+		item := htmlMessage{
+			Time:   tim.Format("15:04"),
+			Sender: e.sender(msg),
+			Kind:   string(msg.Kind),
+			Text:   msg.Text,
+			Media:  e.Media[msg.Id],
+			FromMe: msg.FromMe,
+		}
+		if item.Media != "" {
+			item.Text = e.body(msg)
+		}
+		if day := tim.Format("2006-01-02"); day != lastDay {
+			item.Day = day
+			lastDay = day
+		}
+		data.Messages = append(data.Messages, item)
+	}
+	return exportTemplate.Execute(w, data)
+}
+
+// writeText writes the same layout as the export of the phone app
+func (e *ChatExport) writeText(w io.Writer) error {
+	for _, msg := range e.Messages {
+		tim := time.Unix(int64(msg.Timestamp), 0).Format("02/01/2006, 15:04")
+		text := msg.Text
+		if msg.Kind == MessageKindSystem {
+			// the phone app writes changes of the chat without sender
+			fmt.Fprintf(w, "%s - %s\n", tim, text)
+			continue
+		}
+		if !isTextKind(msg.Kind) {
+			text = "<Media omitted>"
+			if media, ok := e.Media[msg.Id]; ok {
+				text = path.Base(media) + " (file attached)"
+			}
+			if body := e.body(msg); body != "" {
+				text += "\n" + body
+			}
+		}
+		fmt.Fprintf(w, "%s - %s: %s\n", tim, e.sender(msg), text)
+	}
+	return nil
+}
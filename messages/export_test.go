@@ -0,0 +1,70 @@
+package messages
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+func testExport() *ChatExport {
+	return &ChatExport{
+		ChatName: "Team <Chat>",
+		SelfName: "Me",
+		Messages: []Message{
+			{Id: "a", ChatId: "team@g.us", ContactName: "Alice", Timestamp: 100, Text: "first line\nsecond <b>line</b>", Kind: MessageKindText},
+			{Id: "b", ChatId: "team@g.us", FromMe: true, Timestamp: 200, Text: "[IMAGE] look", Kind: MessageKindImage,
+				RawMessage: &waProto.Message{ImageMessage: &waProto.ImageMessage{Caption: proto.String("look")}}},
+		},
+		Media: map[string]string{"b": "export_media/b.jpg"},
+	}
+}
+
+func TestExportJSONLines(t *testing.T) {
+	var out bytes.Buffer
+	if err := testExport().Write(&out, "json"); err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", out.String())
+	}
+	var record exportRecord
+	if err := json.Unmarshal([]byte(lines[1]), &record); err != nil {
+		t.Fatalf("invalid JSON line: %v", err)
+	}
+	if record.Sender != "Me" || record.Caption != "look" || record.Media != "export_media/b.jpg" || record.Kind != "image" {
+		t.Fatalf("unexpected record: %#v", record)
+	}
+}
+
+func TestExportPhoneText(t *testing.T) {
+	var out bytes.Buffer
+	testExport().Write(&out, "txt")
+	first := time.Unix(100, 0).Format("02/01/2006, 15:04")
+	second := time.Unix(200, 0).Format("02/01/2006, 15:04")
+	expected := first + " - Alice: first line\nsecond <b>line</b>\n" +
+		second + " - Me: b.jpg (file attached)\nlook\n"
+	if out.String() != expected {
+		t.Fatalf("unexpected text export:\n%s", out.String())
+	}
+}
+
+func TestExportHTMLEscapesText(t *testing.T) {
+	var out bytes.Buffer
+	testExport().Write(&out, "html")
+	html := out.String()
+	if strings.Contains(html, "<b>line</b>") || !strings.Contains(html, "&lt;b&gt;line&lt;/b&gt;") {
+		t.Fatalf("expected message text to be escaped:\n%s", html)
+	}
+	if !strings.Contains(html, `<img src="export_media/b.jpg"`) || !strings.Contains(html, "<title>Team &lt;Chat&gt;</title>") {
+		t.Fatalf("unexpected html:\n%s", html)
+	}
+	if err := testExport().Write(&out, "pdf"); err == nil {
+		t.Fatal("expected unknown format to fail")
+	}
+}
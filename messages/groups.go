@@ -0,0 +1,235 @@
+package messages
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// RemoveChat removes a chat from the chat list, its messages are kept and
+// show up again when the chat comes back.
+func (md *MessageDatabase) RemoveChat(chatID string) bool {
+	md.chatLock.Lock()
+	defer md.chatLock.Unlock()
+	if _, ok := md.chats[chatID]; !ok {
+		return false
+	}
+	delete(md.chats, chatID)
+	delete(md.groupMembers, chatID)
+	if md.store != nil {
+		_, err := md.store.Exec("DELETE FROM chats WHERE id = ?", chatID)
+		md.reportError(err)
+	}
+	return true
+}
+
+// UpdateGroupMembers adds and removes members of a group, if its members are
+// known at all.
+func (md *MessageDatabase) UpdateGroupMembers(chatID string, added, removed []string) {
+	md.chatLock.Lock()
+	defer md.chatLock.Unlock()
+	members, ok := md.groupMembers[chatID]
+	if !ok {
+		return
+	}
+	gone := make(map[string]bool, len(removed)+len(added))
+	for _, id := range removed {
+		gone[id] = true
+	}
+	for _, id := range added {
+		gone[id] = true
+	}
+	updated := make([]string, 0, len(members)+len(added))
+	for _, id := range members {
+		if !gone[id] {
+			updated = append(updated, id)
+		}
+	}
+	md.groupMembers[chatID] = append(updated, added...)
+}
+
+// handleGroupInfo applies changes of a group to the chat list and shows them
+// as system lines in the chat
+func (eh *eventHandler) handleGroupInfo(evt *events.GroupInfo) {
+	chatID := evt.JID.ToNonAD().String()
+	if evt.Name != nil {
+		eh.sm.db.AddChat(Chat{Id: chatID, IsGroup: true, Name: evt.Name.Name})
+	}
+	eh.sm.db.UpdateGroupMembers(chatID, jidStrings(evt.Join), jidStrings(evt.Leave))
+	eh.addSystemMessages(chatID, evt.Timestamp, groupInfoLines(evt, eh.groupMemberName))
+
+	selfIDs := eh.sm.selfIDs()
+	removed := evt.Delete != nil
+	for _, jid := range evt.Leave {
+		removed = removed || selfIDs[jid.ToNonAD().String()]
+	}
+	if removed {
+		eh.sm.db.RemoveChat(chatID)
+	}
+	eh.sm.uiHandler.SetChats(eh.sm.db.GetChatIds())
+}
+
+// handleJoinedGroup adds a group we were added to or joined to the chat list
+func (eh *eventHandler) handleJoinedGroup(evt *events.JoinedGroup) {
+	chatID := evt.JID.ToNonAD().String()
+	eh.sm.db.AddChat(Chat{Id: chatID, IsGroup: true, Name: evt.Name})
+	eh.sm.db.SetGroupMembers(chatID, participantStrings(evt.Participants))
+
+	var line string
+	switch {
+	case evt.Reason == "invite":
+		line = "You joined using an invite link"
+	case evt.Type == "new" && evt.Sender != nil:
+		line = eh.groupMemberName(*evt.Sender) + " created the group and added you"
+	case evt.Sender != nil:
+		line = eh.groupMemberName(*evt.Sender) + " added you"
+	default:
+		line = "You were added"
+	}
+	timestamp := evt.GroupCreated
+	if evt.Type != "new" || timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	eh.addSystemMessages(chatID, timestamp, []string{line})
+	eh.sm.uiHandler.SetChats(eh.sm.db.GetChatIds())
+}
+
+// addSystemMessages stores lines that describe changes of a chat and shows
+// them if the chat is open
+func (eh *eventHandler) addSystemMessages(chatID string, timestamp time.Time, lines []string) {
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	chatName := eh.sm.db.GetIdName(chatID)
+	for idx, line := range lines {
+		// event times only have seconds, the hash of the line keeps lines of
+		// several events in the same second apart
+		hash := sha256.Sum256([]byte(line))
+		msg := Message{
+			Id:          fmt.Sprintf("system-%s-%d-%d-%x", jidUser(chatID), timestamp.UnixNano(), idx, hash[:4]),
+			ChatId:      chatID,
+			ContactName: chatName,
+			Timestamp:   uint64(timestamp.Unix()),
+			Text:        line,
+			Kind:        MessageKindSystem,
+		}
+		if eh.sm.db.AddMessage(msg, false) && eh.sm.currentReceiver == chatID {
+			eh.sm.uiHandler.NewMessage(msg)
+		}
+	}
+}
+
+// groupMemberName returns the name of a user for system lines, we are "You"
+func (eh *eventHandler) groupMemberName(jid types.JID) string {
+	if eh.sm.selfIDs()[jid.ToNonAD().String()] {
+		return "You"
+	}
+	return eh.getContactName(jid.ToNonAD())
+}
+
+// groupInfoLines describes the changes of a group event as sentences, the
+// sender is named at the start, as "Someone" if unknown
+func groupInfoLines(evt *events.GroupInfo, nameOf func(types.JID) string) []string {
+	sender := "Someone"
+	if evt.Sender != nil {
+		sender = nameOf(*evt.Sender)
+	}
+	names := func(jids []types.JID) string {
+		parts := make([]string, 0, len(jids))
+		for _, jid := range jids {
+			name := nameOf(jid)
+			if name == "You" {
+				name = "you"
+			}
+			parts = append(parts, name)
+		}
+		return strings.Join(parts, ", ")
+	}
+	bySender := func(jids []types.JID) bool {
+		return evt.Sender == nil || len(jids) == 1 && jids[0].ToNonAD() == evt.Sender.ToNonAD()
+	}
+
+	lines := make([]string, 0)
+	if evt.Name != nil {
+		lines = append(lines, sender+" changed the subject to \""+evt.Name.Name+"\"")
+	}
+	if evt.Topic != nil {
+		if evt.Topic.TopicDeleted || evt.Topic.Topic == "" {
+			lines = append(lines, sender+" removed the description")
+		} else {
+			lines = append(lines, sender+" changed the description to \""+evt.Topic.Topic+"\"")
+		}
+	}
+	if evt.Announce != nil {
+		lines = append(lines, sender+" allowed "+yesNo(evt.Announce.IsAnnounce, "only admins", "all members")+" to send messages")
+	}
+	if evt.Locked != nil {
+		lines = append(lines, sender+" allowed "+yesNo(evt.Locked.IsLocked, "only admins", "all members")+" to edit the group info")
+	}
+	if evt.MembershipApprovalMode != nil {
+		lines = append(lines, sender+" turned "+yesNo(evt.MembershipApprovalMode.IsJoinApprovalRequired, "on", "off")+" join approval")
+	}
+	if evt.Ephemeral != nil {
+		if evt.Ephemeral.IsEphemeral {
+			lines = append(lines, sender+" turned on disappearing messages ("+(time.Duration(evt.Ephemeral.DisappearingTimer)*time.Second).String()+")")
+		} else {
+			lines = append(lines, sender+" turned off disappearing messages")
+		}
+	}
+	if evt.NewInviteLink != nil {
+		lines = append(lines, sender+" reset the invite link")
+	}
+	if len(evt.Join) > 0 {
+		switch {
+		case evt.JoinReason == "invite":
+			lines = append(lines, names(evt.Join)+" joined using an invite link")
+		case bySender(evt.Join):
+			lines = append(lines, names(evt.Join)+" joined")
+		default:
+			lines = append(lines, sender+" added "+names(evt.Join))
+		}
+	}
+	if len(evt.Leave) > 0 {
+		if bySender(evt.Leave) {
+			lines = append(lines, names(evt.Leave)+" left")
+		} else {
+			lines = append(lines, sender+" removed "+names(evt.Leave))
+		}
+	}
+	if len(evt.Promote) > 0 {
+		lines = append(lines, sender+" made "+names(evt.Promote)+" admin")
+	}
+	if len(evt.Demote) > 0 {
+		lines = append(lines, sender+" dismissed "+names(evt.Demote)+" as admin")
+	}
+	if evt.Delete != nil {
+		lines = append(lines, sender+" deleted the group")
+	}
+	for idx, line := range lines {
+		// names of joined or left users start a sentence
+		if strings.HasPrefix(line, "you ") {
+			lines[idx] = "Y" + line[1:]
+		}
+	}
+	return lines
+}
+
+func jidStrings(jids []types.JID) []string {
+	out := make([]string, 0, len(jids))
+	for _, jid := range jids {
+		out = append(out, jid.ToNonAD().String())
+	}
+	return out
+}
+
+func participantStrings(participants []types.GroupParticipant) []string {
+	out := make([]string, 0, len(participants))
+	for _, participant := range participants {
+		out = append(out, participant.JID.ToNonAD().String())
+	}
+	return out
+}
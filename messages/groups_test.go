@@ -0,0 +1,162 @@
+package messages
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func TestGroupInfoLines(t *testing.T) {
+	me := types.NewJID("100", types.DefaultUserServer)
+	alice := types.NewJID("111", types.DefaultUserServer)
+	bob := types.NewJID("222", types.DefaultUserServer)
+	nameOf := func(jid types.JID) string {
+		switch jid {
+		case me:
+			return "You"
+		case alice:
+			return "Alice"
+		}
+		return "Bob"
+	}
+
+	evt := &events.GroupInfo{
+		Sender:    &alice,
+		Name:      &types.GroupName{Name: "Hiking"},
+		Topic:     &types.GroupTopic{TopicDeleted: true},
+		Announce:  &types.GroupAnnounce{IsAnnounce: true},
+		Ephemeral: &types.GroupEphemeral{IsEphemeral: true, DisappearingTimer: 86400},
+		Join:      []types.JID{bob, me},
+		Promote:   []types.JID{me},
+	}
+	expected := []string{
+		`Alice changed the subject to "Hiking"`,
+		"Alice removed the description",
+		"Alice allowed only admins to send messages",
+		"Alice turned on disappearing messages (24h0m0s)",
+		"Alice added Bob, you",
+		"Alice made you admin",
+	}
+	if lines := groupInfoLines(evt, nameOf); !reflect.DeepEqual(lines, expected) {
+		t.Fatalf("unexpected lines: %q", lines)
+	}
+
+	evt = &events.GroupInfo{Sender: &me, Leave: []types.JID{me}}
+	if lines := groupInfoLines(evt, nameOf); !reflect.DeepEqual(lines, []string{"You left"}) {
+		t.Fatalf("unexpected lines: %q", lines)
+	}
+	evt = &events.GroupInfo{Sender: &alice, Leave: []types.JID{bob}}
+	if lines := groupInfoLines(evt, nameOf); !reflect.DeepEqual(lines, []string{"Alice removed Bob"}) {
+		t.Fatalf("unexpected lines: %q", lines)
+	}
+	evt = &events.GroupInfo{Join: []types.JID{bob}, JoinReason: "invite"}
+	if lines := groupInfoLines(evt, nameOf); !reflect.DeepEqual(lines, []string{"Bob joined using an invite link"}) {
+		t.Fatalf("unexpected lines: %q", lines)
+	}
+}
+
+func TestGroupMembersAndRemoveChat(t *testing.T) {
+	db := &MessageDatabase{}
+	db.Init()
+	group := "333" + GROUPSUFFIX
+	alice := "111" + CONTACTSUFFIX
+	bob := "222" + CONTACTSUFFIX
+
+	db.UpdateGroupMembers(group, []string{alice}, nil)
+	if db.HasGroupMembers(group) {
+		t.Fatal("expected unknown members to stay unknown")
+	}
+	db.SetGroupMembers(group, []string{alice})
+	db.UpdateGroupMembers(group, []string{bob}, []string{alice})
+	if members := db.GetGroupMembers(group); !reflect.DeepEqual(members, []string{bob}) {
+		t.Fatalf("unexpected members: %v", members)
+	}
+
+	db.AddMessage(Message{Id: "m1", ChatId: group, ContactName: "Hiking", Timestamp: 10, Text: "hi"}, false)
+	db.AddMessage(Message{Id: "system-1", ChatId: group, Timestamp: 20, Text: "Alice added Bob", Kind: MessageKindSystem}, false)
+	db.UpdateChatUnread(group, 1)
+	if msg, _ := db.GetMessage("m1"); !msg.Unread {
+		t.Fatal("expected system lines to be skipped when marking unread")
+	}
+
+	if !db.RemoveChat(group) || len(db.GetChatIds()) != 0 || db.HasGroupMembers(group) {
+		t.Fatal("expected chat to be removed")
+	}
+	if len(db.GetMessages(group)) != 2 {
+		t.Fatal("expected messages of a removed chat to be kept")
+	}
+	db.AddMessage(Message{Id: "m2", ChatId: group, Timestamp: 30, Text: "back"}, false)
+	if chats := db.GetChatIds(); len(chats) != 1 {
+		t.Fatalf("expected chat to come back, got %v", chats)
+	}
+}
+
+func TestSystemLinesInSameSecond(t *testing.T) {
+	sm := &SessionManager{}
+	sm.Init(nil)
+	chatID := "group@g.us"
+	timestamp := time.Unix(1700000000, 0)
+	sm.eventHandler.addSystemMessages(chatID, timestamp, []string{"Alice added Bob"})
+	sm.eventHandler.addSystemMessages(chatID, timestamp, []string{"Alice made Bob admin"})
+	msgs := sm.db.GetMessages(chatID)
+	if len(msgs) != 2 || msgs[0].Id == msgs[1].Id {
+		t.Fatalf("expected both lines, got %#v", msgs)
+	}
+}
+
+// errorUi records the errors the session manager prints, other output is not expected
+type errorUi struct {
+	UiMessageHandler
+	errors []error
+}
+
+func (ui *errorUi) PrintError(err error) {
+	if err != nil {
+		ui.errors = append(ui.errors, err)
+	}
+}
+
+func TestGroupCommandsWithoutClient(t *testing.T) {
+	ui := &errorUi{}
+	sm := &SessionManager{}
+	sm.Init(ui)
+	sm.currentReceiver = "group@g.us"
+	commands := []Command{
+		{"description", []string{"new", "text"}},
+		{"announce", []string{"on"}},
+		{"locked", []string{"off"}},
+		{"approval", []string{"on"}},
+		{"disappearing", []string{"24h"}},
+		{"invitelink", nil},
+		{"join", []string{"https://chat.whatsapp.com/abc"}},
+	}
+	for _, command := range commands {
+		ui.errors = nil
+		sm.execCommand(command)
+		if len(ui.errors) != 1 || ui.errors[0].Error() != "not connected to WhatsApp" {
+			t.Fatalf("unexpected errors for %s: %v", command.Name, ui.errors)
+		}
+	}
+}
+
+func TestJoinNeedsShownGroup(t *testing.T) {
+	ui := &textUi{}
+	sm := &SessionManager{}
+	sm.Init(ui)
+	sm.execCommand(Command{"join", nil})
+	if len(ui.texts) != 1 || !strings.Contains(ui.texts[0], "Usage:") || len(ui.errors) != 0 {
+		t.Fatalf("expected usage without shown group, got %q %v", ui.texts, ui.errors)
+	}
+	sm.invite = &groupInvite{code: "abc"}
+	sm.execCommand(Command{"join", nil})
+	if len(ui.errors) != 1 || ui.errors[0].Error() != "not connected to WhatsApp" {
+		t.Fatalf("expected the shown group to be joined, got %v", ui.errors)
+	}
+	if sm.invite == nil {
+		t.Fatal("expected the shown group to be kept when joining is not possible")
+	}
+}
@@ -0,0 +1,341 @@
+package messages
+
+import (
+	"archive/zip"
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// message headers of phone exports, e.g. Android "17/10/2026, 15:04 - Name: text"
+// and iOS "[17/10/2026, 15:04:05] Name: text"
+var androidHeaderPattern = regexp.MustCompile(`^(\d{1,4}[./-]\d{1,2}[./-]\d{1,4}),? (\d{1,2}[:.]\d{2}(?:[:.]\d{2})?)\s?([AaPp]\.?\s?[Mm]\.?)? [-–] (.*)$`)
+var iosHeaderPattern = regexp.MustCompile(`^\[(\d{1,4}[./-]\d{1,2}[./-]\d{1,4}),? (\d{1,2}[:.]\d{2}(?:[:.]\d{2})?)\s?([AaPp]\.?\s?[Mm]\.?)?\] (.*)$`)
+var iosAttachmentPattern = regexp.MustCompile(`^<(?:attached|Anhang|adjunto|pièce jointe|allegato|anexo): (.+)>$`)
+var exportFileNamePattern = regexp.MustCompile(`^WhatsApp Chat (?:with|mit|con|avec|met|com|-) (.+?)(?: \(\d+\))?$`)
+var androidAttachmentPattern = regexp.MustCompile(`^(.+\.[A-Za-z0-9]{2,5}) \((?:file attached|Datei angehängt|archivo adjunto|fichier joint|file allegato|arquivo anexado)\)$`)
+
+// a message parsed from a chat exported with the phone app
+type ImportedMessage struct {
+	Time       time.Time
+	Sender     string
+	Text       string
+	Attachment string
+}
+
+// a message header before its date could be interpreted
+type rawImportedMessage struct {
+	date, clock, ampm string
+	sender, text      string
+}
+
+// ParseChatExport parses the text of a chat exported with the phone app.
+// Day and month order is detected from the dates in the file. Lines without
+// header continue the previous message, system lines without sender are skipped.
+func ParseChatExport(r io.Reader) ([]ImportedMessage, error) {
+	raws := make([]*rawImportedMessage, 0)
+	var last *rawImportedMessage
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.Map(func(r rune) rune {
+			switch r {
+			case '\u200e', '\u200f', '\ufeff':
+				return -1
+			case '\u202f', '\u00a0':
+				return ' '
+			}
+			return r
+		}, strings.TrimRight(scanner.Text(), "\r"))
+		match := androidHeaderPattern.FindStringSubmatch(line)
+		if match == nil {
+			match = iosHeaderPattern.FindStringSubmatch(line)
+		}
+		if match == nil {
+			if last != nil {
+				last.text += "\n" + line
+			}
+			continue
+		}
+		last = &rawImportedMessage{date: match[1], clock: match[2], ampm: match[3]}
+		if idx := strings.Index(match[4], ": "); idx > 0 {
+			last.sender = match[4][:idx]
+			last.text = match[4][idx+2:]
+		}
+		raws = append(raws, last)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(raws) == 0 {
+		return nil, errors.New("no messages found, this does not look like a WhatsApp chat export")
+	}
+
+	dayFirst := detectDayFirst(raws)
+	out := make([]ImportedMessage, 0, len(raws))
+	for _, raw := range raws {
+		if raw.sender == "" {
+			continue
+		}
+		tim, err := parseExportTime(raw.date, raw.clock, raw.ampm, dayFirst)
+		if err != nil {
+			return nil, err
+		}
+		msg := ImportedMessage{Time: tim, Sender: raw.sender, Text: raw.text}
+		if match := iosAttachmentPattern.FindStringSubmatch(raw.text); match != nil {
+			msg.Attachment = match[1]
+			msg.Text = ""
+		} else if first, rest, _ := strings.Cut(raw.text, "\n"); androidAttachmentPattern.MatchString(first) {
+			msg.Attachment = androidAttachmentPattern.FindStringSubmatch(first)[1]
+			msg.Text = rest
+		}
+		out = append(out, msg)
+	}
+	return out, nil
+}
+
+// detectDayFirst decides if dates are written day first (17/10/26) or month first (10/17/26)
+func detectDayFirst(raws []*rawImportedMessage) bool {
+	usesAmPm := false
+	for _, raw := range raws {
+		parts := splitExportDate(raw.date)
+		if len(parts[0]) == 4 {
+			return false
+		}
+		if first, _ := strconv.Atoi(parts[0]); first > 12 {
+			return true
+		}
+		if second, _ := strconv.Atoi(parts[1]); second > 12 {
+			return false
+		}
+		usesAmPm = usesAmPm || raw.ampm != ""
+	}
+	return !usesAmPm
+}
+
+func splitExportDate(date string) []string {
+	return strings.FieldsFunc(date, func(r rune) bool {
+		return r == '/' || r == '.' || r == '-'
+	})
+}
+
+func parseExportTime(date, clock, ampm string, dayFirst bool) (time.Time, error) {
+	parts := splitExportDate(date)
+	numbers := make([]int, 0, 3)
+	for _, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid date %q", date)
+		}
+		numbers = append(numbers, number)
+	}
+	var year, month, day int
+	switch {
+	case len(numbers) != 3:
+		return time.Time{}, fmt.Errorf("invalid date %q", date)
+	case len(parts[0]) == 4:
+		year, month, day = numbers[0], numbers[1], numbers[2]
+	case dayFirst:
+		day, month, year = numbers[0], numbers[1], numbers[2]
+	default:
+		month, day, year = numbers[0], numbers[1], numbers[2]
+	}
+	if year < 100 {
+		year += 2000
+	}
+
+	clockParts := strings.FieldsFunc(clock, func(r rune) bool {
+		return r == ':' || r == '.'
+	})
+	hour, _ := strconv.Atoi(clockParts[0])
+	minute, _ := strconv.Atoi(clockParts[1])
+	second := 0
+	if len(clockParts) > 2 {
+		second, _ = strconv.Atoi(clockParts[2])
+	}
+	switch strings.ToLower(strings.NewReplacer(".", "", " ", "").Replace(ampm)) {
+	case "am":
+		if hour == 12 {
+			hour = 0
+		}
+	case "pm":
+		if hour < 12 {
+			hour += 12
+		}
+	}
+	if month < 1 || month > 12 || day < 1 || day > 31 || hour > 23 || minute > 59 || second > 59 {
+		return time.Time{}, fmt.Errorf("invalid date %q %q", date, clock)
+	}
+	return time.Date(year, time.Month(month), day, hour, minute, second, 0, time.Local), nil
+}
+
+// ReadChatExport reads a .txt or .zip chat export. Attachments contained in a
+// zip file are extracted into mediaDir, their paths are returned by file name.
+func ReadChatExport(file, mediaDir string) ([]ImportedMessage, map[string]string, error) {
+	if !strings.EqualFold(filepath.Ext(file), ".zip") {
+		reader, err := os.Open(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer reader.Close()
+		msgs, err := ParseChatExport(reader)
+		return msgs, nil, err
+	}
+
+	archive, err := zip.OpenReader(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer archive.Close()
+	var chatFile *zip.File
+	files := make(map[string]*zip.File)
+	for _, entry := range archive.File {
+		name := path.Base(entry.Name)
+		files[name] = entry
+		if chatFile == nil && strings.EqualFold(path.Ext(name), ".txt") {
+			chatFile = entry
+		}
+	}
+	if chatFile == nil {
+		return nil, nil, errors.New("no chat text file found in archive")
+	}
+	reader, err := chatFile.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	msgs, err := ParseChatExport(reader)
+	reader.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	media := make(map[string]string)
+	for _, msg := range msgs {
+		entry, ok := files[msg.Attachment]
+		if !ok || entry == chatFile {
+			continue
+		}
+		target := filepath.Join(mediaDir, msg.Attachment)
+		if err = extractZipFile(entry, target); err != nil {
+			return nil, nil, err
+		}
+		media[msg.Attachment] = target
+	}
+	return msgs, media, nil
+}
+
+func extractZipFile(entry *zip.File, target string) error {
+	if _, err := os.Stat(target); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	reader, err := entry.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, reader); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// ImportedMessages converts parsed export messages into read-only messages of a chat.
+// Messages of selfName are marked as own messages. The IDs only depend on the
+// message content, so importing an export again does not add duplicates.
+func ImportedMessages(chatID, selfName string, imported []ImportedMessage, media map[string]string) []Message {
+	isGroup := strings.HasSuffix(chatID, GROUPSUFFIX)
+	out := make([]Message, 0, len(imported))
+	sameTime := 0
+	for idx, item := range imported {
+		if idx > 0 && item.Time.Equal(imported[idx-1].Time) {
+			sameTime++
+		} else {
+			sameTime = 0
+		}
+		hash := sha1.Sum([]byte(chatID + "\x00" + item.Sender + "\x00" + item.Text + "\x00" + item.Attachment))
+		msg := Message{
+			Id:           fmt.Sprintf("import-%d-%03d-%s", item.Time.Unix(), sameTime, hex.EncodeToString(hash[:5])),
+			ChatId:       chatID,
+			ContactName:  item.Sender,
+			ContactShort: item.Sender,
+			Timestamp:    uint64(item.Time.Unix()),
+			FromMe:       selfName != "" && item.Sender == selfName,
+			Text:         item.Text,
+			Kind:         MessageKindText,
+			Imported:     true,
+		}
+		if !isGroup && !msg.FromMe {
+			msg.ContactId = chatID
+		}
+		if item.Attachment != "" {
+			msg.Kind = importedAttachmentKind(item.Attachment)
+			msg.FileName = item.Attachment
+			msg.MimeType = detectMimeType(item.Attachment, nil)
+			msg.LocalPath = media[item.Attachment]
+			msg.Text = mediaDisplayText(msg.Kind, item.Attachment, item.Text, 0)
+		}
+		out = append(out, msg)
+	}
+	return out
+}
+
+func importedAttachmentKind(fileName string) MessageKind {
+	kind := kindForMimeType(detectMimeType(fileName, nil))
+	if ext := strings.ToLower(filepath.Ext(fileName)); ext == ".opus" {
+		kind = MessageKindAudio
+		// the phone app names voice notes PTT-date-number.opus
+		if strings.HasPrefix(fileName, "PTT-") {
+			kind = MessageKindVoice
+		}
+	}
+	return kind
+}
+
+// ExportChatName returns the chat name contained in the file name of a chat export,
+// e.g. "WhatsApp Chat with Alice.zip" or "WhatsApp Chat - Alice.zip"
+func ExportChatName(file string) string {
+	name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	if match := exportFileNamePattern.FindStringSubmatch(name); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// guessSelfName finds the sender name of the own messages in an export. This is
+// the push name if it appears, in single chats it is the sender that is not the chat.
+func guessSelfName(imported []ImportedMessage, chatName, pushName string, isGroup bool) string {
+	senders := make(map[string]bool)
+	for _, msg := range imported {
+		senders[msg.Sender] = true
+	}
+	if pushName != "" && senders[pushName] {
+		return pushName
+	}
+	if isGroup || len(senders) != 2 || !senders[chatName] {
+		return ""
+	}
+	for sender := range senders {
+		if sender != chatName {
+			return sender
+		}
+	}
+	return ""
+}
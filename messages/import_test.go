@@ -0,0 +1,90 @@
+package messages
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAndroidExport(t *testing.T) {
+	export := "17/10/2026, 15:04 - Messages and calls are end-to-end encrypted.\n" +
+		"17/10/2026, 15:04 - Alice: first line\n" +
+		"second line\n" +
+		"18/10/2026, 09:30 - Bob: IMG-20261018-WA0001.jpg (file attached)\n" +
+		"look at this\n" +
+		"18/10/2026, 09:31 - Bob: <Media omitted>\n"
+	msgs, err := ParseChatExport(strings.NewReader(export))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if len(msgs) != 3 {
+		t.Fatalf("expected 3 messages, got %#v", msgs)
+	}
+	if msgs[0].Sender != "Alice" || msgs[0].Text != "first line\nsecond line" {
+		t.Fatalf("unexpected first message: %#v", msgs[0])
+	}
+	if !msgs[0].Time.Equal(time.Date(2026, 10, 17, 15, 4, 0, 0, time.Local)) {
+		t.Fatalf("unexpected time: %v", msgs[0].Time)
+	}
+	if msgs[1].Attachment != "IMG-20261018-WA0001.jpg" || msgs[1].Text != "look at this" {
+		t.Fatalf("unexpected attachment message: %#v", msgs[1])
+	}
+}
+
+func TestParseExportDateFormats(t *testing.T) {
+	tests := []struct {
+		export   string
+		expected time.Time
+	}{
+		{"[17.10.26, 15:04:05] Alice: hi\n", time.Date(2026, 10, 17, 15, 4, 5, 0, time.Local)},
+		{"10/17/26, 3:04 PM - Alice: hi\n", time.Date(2026, 10, 17, 15, 4, 0, 0, time.Local)},
+		{"[2/3/26, 12:10:00 AM] Alice: hi\n", time.Date(2026, 2, 3, 0, 10, 0, 0, time.Local)},
+		{"02/03/2026, 12:10 - Alice: hi\n", time.Date(2026, 3, 2, 12, 10, 0, 0, time.Local)},
+		{"2026-10-17, 15:04 - Alice: hi\n", time.Date(2026, 10, 17, 15, 4, 0, 0, time.Local)},
+		{"\u200e[17/10/2026, 3:04:05\u202fPM] Alice: \u200e<attached: 00000012-PHOTO.jpg>\n", time.Date(2026, 10, 17, 15, 4, 5, 0, time.Local)},
+	}
+	for _, test := range tests {
+		msgs, err := ParseChatExport(strings.NewReader(test.export))
+		if err != nil || len(msgs) != 1 {
+			t.Fatalf("parse of %q failed: %v %#v", test.export, err, msgs)
+		}
+		if !msgs[0].Time.Equal(test.expected) {
+			t.Fatalf("parse of %q: expected %v, got %v", test.export, test.expected, msgs[0].Time)
+		}
+	}
+}
+
+func TestImportedMessagesAreStable(t *testing.T) {
+	imported := []ImportedMessage{
+		{Time: time.Unix(600, 0), Sender: "Alice", Text: "hi"},
+		{Time: time.Unix(600, 0), Sender: "Me Myself", Text: "hi"},
+		{Time: time.Unix(660, 0), Sender: "Alice", Attachment: "doc.pdf"},
+	}
+	msgs := ImportedMessages("123@s.whatsapp.net", "Me Myself", imported, map[string]string{"doc.pdf": "/tmp/doc.pdf"})
+	again := ImportedMessages("123@s.whatsapp.net", "Me Myself", imported, nil)
+	if msgs[0].Id == msgs[1].Id || msgs[1].Id != again[1].Id {
+		t.Fatalf("expected distinct and stable ids, got %q %q %q", msgs[0].Id, msgs[1].Id, again[1].Id)
+	}
+	if msgs[0].Id >= msgs[1].Id {
+		t.Fatalf("messages with the same time should keep their order: %q %q", msgs[0].Id, msgs[1].Id)
+	}
+	if msgs[0].FromMe || !msgs[1].FromMe || msgs[0].ContactId != "123@s.whatsapp.net" || !msgs[0].Imported {
+		t.Fatalf("unexpected messages: %#v", msgs[:2])
+	}
+	if msgs[2].Kind != MessageKindDocument || msgs[2].LocalPath != "/tmp/doc.pdf" || msgs[2].Text != "[DOCUMENT] doc.pdf" {
+		t.Fatalf("unexpected attachment message: %#v", msgs[2])
+	}
+}
+
+func TestGuessSelfName(t *testing.T) {
+	imported := []ImportedMessage{{Sender: "Alice"}, {Sender: "Bob"}}
+	if name := guessSelfName(imported, "Alice", "", false); name != "Bob" {
+		t.Fatalf("expected Bob, got %q", name)
+	}
+	if name := guessSelfName(imported, "Alice", "", true); name != "" {
+		t.Fatalf("expected no name in groups, got %q", name)
+	}
+	if name := ExportChatName("/tmp/WhatsApp Chat with Alice (2).zip"); name != "Alice" {
+		t.Fatalf("expected Alice, got %q", name)
+	}
+}
@@ -0,0 +1,135 @@
+package messages
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+// locationText shows the name, address and coordinates of a location pin
+func locationText(loc *waProto.LocationMessage) string {
+	parts := []string{"[LOCATION]"}
+	if loc.GetName() != "" {
+		parts = append(parts, loc.GetName()+",")
+	}
+	if loc.GetAddress() != "" {
+		parts = append(parts, strings.ReplaceAll(loc.GetAddress(), "\n", ", ")+",")
+	}
+	parts = append(parts, formatCoordinates(loc.GetDegreesLatitude(), loc.GetDegreesLongitude()))
+	if loc.GetComment() != "" {
+		parts = append(parts, loc.GetComment())
+	}
+	return strings.Join(parts, " ")
+}
+
+// liveLocationText shows the current position of a live location with the
+// time of the last update
+func liveLocationText(loc *waProto.LiveLocationMessage, updated time.Time) string {
+	parts := []string{"[LIVE LOCATION]", formatCoordinates(loc.GetDegreesLatitude(), loc.GetDegreesLongitude())}
+	if loc.GetCaption() != "" {
+		parts = append(parts, loc.GetCaption())
+	}
+	parts = append(parts, "(updated "+updated.Format("15:04")+")")
+	return strings.Join(parts, " ")
+}
+
+func formatCoordinates(lat, lon float64) string {
+	return fmt.Sprintf("%.5f, %.5f", lat, lon)
+}
+
+// locationURL returns an OpenStreetMap link to the position of a location
+// or live location message
+func locationURL(raw *waProto.Message) string {
+	var lat, lon float64
+	switch {
+	case raw.GetLocationMessage() != nil:
+		lat, lon = raw.GetLocationMessage().GetDegreesLatitude(), raw.GetLocationMessage().GetDegreesLongitude()
+	case raw.GetLiveLocationMessage() != nil:
+		lat, lon = raw.GetLiveLocationMessage().GetDegreesLatitude(), raw.GetLiveLocationMessage().GetDegreesLongitude()
+	default:
+		return ""
+	}
+	return fmt.Sprintf("https://www.openstreetmap.org/?mlat=%.6f&mlon=%.6f#map=17/%.6f/%.6f", lat, lon, lat, lon)
+}
+
+// UpdateLiveLocation shows a new position of a live location in the message
+// that started it, so it stays a single line. It returns false if the sender
+// has no live location in the chat yet.
+func (md *MessageDatabase) UpdateLiveLocation(msg Message) bool {
+	live := msg.RawMessage.GetLiveLocationMessage()
+	if live == nil {
+		return false
+	}
+	md.messageLock.Lock()
+	defer md.messageLock.Unlock()
+	msgs := md.messages[msg.ChatId]
+	for idx := len(msgs) - 1; idx >= 0; idx-- {
+		existing := msgs[idx]
+		if existing.SenderId != msg.SenderId || existing.RawMessage.GetLiveLocationMessage() == nil {
+			continue
+		}
+		if existing.Id == msg.Id {
+			return false
+		}
+		// the first message keeps the caption, updates often come without
+		if live.GetCaption() == "" && existing.RawMessage.GetLiveLocationMessage().GetCaption() != "" {
+			live = proto.Clone(live).(*waProto.LiveLocationMessage)
+			live.Caption = proto.String(existing.RawMessage.GetLiveLocationMessage().GetCaption())
+		}
+		existing.RawMessage = &waProto.Message{LiveLocationMessage: live}
+		existing.Text = liveLocationText(live, time.Unix(int64(msg.Timestamp), 0))
+		md.messagesById[existing.Id] = existing
+		md.replaceMessageLocked(existing)
+		return true
+	}
+	return false
+}
+
+// sendLocationCommand sends a location pin to the current chat
+func (sm *SessionManager) sendLocationCommand(params []string) {
+	if sm.currentReceiver == "" {
+		sm.printCommandUsage("sendlocation", "-> only works in a chat")
+		return
+	}
+	if !checkParam(params, 2) {
+		sm.printCommandUsage("sendlocation", "latitude longitude [name[]")
+		return
+	}
+	lat, lon, err := parseCoordinates(params[0], params[1])
+	if err != nil {
+		sm.uiHandler.PrintError(err)
+		return
+	}
+	loc := &waProto.LocationMessage{
+		DegreesLatitude:  proto.Float64(lat),
+		DegreesLongitude: proto.Float64(lon),
+	}
+	if name := strings.Join(params[2:], " "); name != "" {
+		loc.Name = proto.String(name)
+	}
+	sm.uiHandler.PrintError(sm.sendOrQueue(OutboxEntry{
+		ChatId: sm.currentReceiver,
+		Kind:   MessageKindLocation,
+		Text:   locationText(loc),
+		Raw:    &waProto.Message{LocationMessage: loc},
+	}))
+}
+
+// parseCoordinates parses latitude and longitude in degrees, a trailing comma
+// of the latitude as copied from maps is ignored
+func parseCoordinates(latText, lonText string) (float64, float64, error) {
+	lat, err := strconv.ParseFloat(strings.TrimSuffix(latText, ","), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return 0, 0, errors.New("latitude must be a number from -90 to 90")
+	}
+	lon, err := strconv.ParseFloat(lonText, 64)
+	if err != nil || lon < -180 || lon > 180 {
+		return 0, 0, errors.New("longitude must be a number from -180 to 180")
+	}
+	return lat, lon, nil
+}
@@ -0,0 +1,89 @@
+package messages
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestLocationText(t *testing.T) {
+	loc := &waProto.LocationMessage{
+		DegreesLatitude:  proto.Float64(52.516275),
+		DegreesLongitude: proto.Float64(13.377704),
+		Name:             proto.String("Brandenburger Tor"),
+		Address:          proto.String("Pariser Platz\n10117 Berlin"),
+	}
+	if text := locationText(loc); text != "[LOCATION] Brandenburger Tor, Pariser Platz, 10117 Berlin, 52.51628, 13.37770" {
+		t.Fatalf("unexpected text: %q", text)
+	}
+	url := locationURL(&waProto.Message{LocationMessage: loc})
+	if url != "https://www.openstreetmap.org/?mlat=52.516275&mlon=13.377704#map=17/52.516275/13.377704" {
+		t.Fatalf("unexpected url: %q", url)
+	}
+	if locationURL(&waProto.Message{Conversation: proto.String("hi")}) != "" {
+		t.Fatal("expected no url for text messages")
+	}
+
+	if lat, lon, err := parseCoordinates("52.5,", "-13.25"); err != nil || lat != 52.5 || lon != -13.25 {
+		t.Fatalf("unexpected coordinates: %v %v %v", lat, lon, err)
+	}
+	if _, _, err := parseCoordinates("91", "0"); err == nil {
+		t.Fatal("expected latitude out of range to fail")
+	}
+	if _, _, err := parseCoordinates("0", "east"); err == nil {
+		t.Fatal("expected invalid longitude to fail")
+	}
+}
+
+func TestLiveLocationUpdatesSingleLine(t *testing.T) {
+	sm := &SessionManager{}
+	sm.Init(nil)
+	alice := types.NewJID("111", types.DefaultUserServer)
+	live := func(id string, lat float64, caption string, at time.Time) *events.Message {
+		loc := &waProto.LiveLocationMessage{
+			DegreesLatitude:  proto.Float64(lat),
+			DegreesLongitude: proto.Float64(13.4),
+		}
+		if caption != "" {
+			loc.Caption = proto.String(caption)
+		}
+		return &events.Message{
+			Info: types.MessageInfo{
+				MessageSource: types.MessageSource{Chat: alice, Sender: alice},
+				ID:            types.MessageID(id),
+				Timestamp:     at,
+			},
+			Message: &waProto.Message{LiveLocationMessage: loc},
+		}
+	}
+	start := time.Date(2026, 10, 17, 15, 4, 0, 0, time.Local)
+
+	msg, action, ok := sm.eventHandler.normalizeEventMessage(live("l1", 52.5, "on my way", start))
+	if !ok || action != "live" || msg.Kind != MessageKindLocation {
+		t.Fatalf("unexpected live location: %v %#v", action, msg)
+	}
+	if sm.db.UpdateLiveLocation(msg) {
+		t.Fatal("expected first live location to be added")
+	}
+	sm.db.AddMessage(msg, false)
+
+	msg, _, _ = sm.eventHandler.normalizeEventMessage(live("l2", 52.6, "", start.Add(5*time.Minute)))
+	if !sm.db.UpdateLiveLocation(msg) {
+		t.Fatal("expected update of the live location")
+	}
+	msgs := sm.db.GetMessages(alice.String())
+	if len(msgs) != 1 || msgs[0].Id != "l1" {
+		t.Fatalf("expected a single line, got %#v", msgs)
+	}
+	if msgs[0].Text != "[LIVE LOCATION] 52.60000, 13.40000 on my way (updated 15:09)" {
+		t.Fatalf("unexpected text: %q", msgs[0].Text)
+	}
+	if !strings.Contains(locationURL(msgs[0].RawMessage), "mlat=52.600000") {
+		t.Fatal("expected url of the new position")
+	}
+}
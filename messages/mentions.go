@@ -0,0 +1,195 @@
+package messages
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"unicode"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// matches @name tokens at the start of the text or after white space
+var mentionPattern = regexp.MustCompile(`(^|\s)@([\pL\pN_\-]+)`)
+
+// SetGroupMembers stores the members of a group, as returned by the server.
+func (md *MessageDatabase) SetGroupMembers(chatID string, members []string) {
+	md.chatLock.Lock()
+	defer md.chatLock.Unlock()
+	md.groupMembers[chatID] = members
+}
+
+// HasGroupMembers returns true if the members of a group are known.
+func (md *MessageDatabase) HasGroupMembers(chatID string) bool {
+	md.chatLock.RLock()
+	defer md.chatLock.RUnlock()
+	_, ok := md.groupMembers[chatID]
+	return ok
+}
+
+// GetGroupMembers returns the members of a group as far as they are known,
+// together with everyone else who sent messages to it.
+func (md *MessageDatabase) GetGroupMembers(chatID string) []string {
+	senders := md.GetChatSenders(chatID)
+	md.chatLock.RLock()
+	members := append([]string{}, md.groupMembers[chatID]...)
+	md.chatLock.RUnlock()
+	known := make(map[string]bool, len(members))
+	for _, id := range members {
+		known[id] = true
+	}
+	for _, id := range senders {
+		if !known[id] {
+			members = append(members, id)
+		}
+	}
+	return members
+}
+
+// ResolveMentions finds @name and @number tokens in the text of a message to
+// a group and resolves them against the group members. Tokens naming a single
+// member are replaced by @number, as clients expect, and the member is
+// returned as mentioned. Tokens that match nobody or several members stay.
+func (md *MessageDatabase) ResolveMentions(chatID, text string) (string, []string) {
+	members := md.GetGroupMembers(chatID)
+	mentioned := make([]string, 0)
+	seen := make(map[string]bool)
+	out := ""
+	last := 0
+	for _, match := range mentionPattern.FindAllStringSubmatchIndex(text, -1) {
+		token := text[match[4]:match[5]]
+		id := md.findMember(members, token)
+		if id == "" {
+			continue
+		}
+		if !seen[id] {
+			seen[id] = true
+			mentioned = append(mentioned, id)
+		}
+		out += text[last:match[4]] + jidUser(id)
+		last = match[5]
+	}
+	return out + text[last:], mentioned
+}
+
+// findMember returns the member a mention token refers to, exact names win
+// over first names, numbers need not be members
+func (md *MessageDatabase) findMember(members []string, token string) string {
+	if isNumber(token) {
+		for _, id := range members {
+			if jidUser(id) == token {
+				return id
+			}
+		}
+		if len(token) >= 7 {
+			return token + CONTACTSUFFIX
+		}
+		return ""
+	}
+	token = strings.ToLower(token)
+	exact := make([]string, 0)
+	firstName := make([]string, 0)
+	for _, id := range members {
+		name := strings.ToLower(md.GetIdName(id))
+		short := strings.ToLower(md.GetIdShort(id))
+		switch {
+		case strings.ReplaceAll(name, " ", "") == token, strings.ReplaceAll(short, " ", "") == token:
+			exact = append(exact, id)
+		case strings.SplitN(name, " ", 2)[0] == token, strings.SplitN(short, " ", 2)[0] == token:
+			firstName = append(firstName, id)
+		}
+	}
+	if len(exact) == 1 {
+		return exact[0]
+	}
+	if len(exact) == 0 && len(firstName) == 1 {
+		return firstName[0]
+	}
+	return ""
+}
+
+// applyMentions stores the users mentioned in a message with their names
+func (eh *eventHandler) applyMentions(msg *Message, ctx *waProto.ContextInfo) {
+	selfIDs := eh.sm.selfIDs()
+	for _, raw := range ctx.GetMentionedJID() {
+		jid, err := types.ParseJID(raw)
+		if err != nil {
+			continue
+		}
+		jid = jid.ToNonAD()
+		if selfIDs[jid.String()] {
+			msg.MentionsMe = !msg.FromMe
+			msg.Mentions = append(msg.Mentions, Mention{Id: jid.String(), Name: "Me"})
+			continue
+		}
+		msg.Mentions = append(msg.Mentions, Mention{Id: jid.String(), Name: eh.getContactShort(jid)})
+	}
+}
+
+// selfIDs returns our own user ids, by phone number and by LID
+func (sm *SessionManager) selfIDs() map[string]bool {
+	ids := make(map[string]bool)
+	if sm.client == nil || sm.client.Store == nil {
+		return ids
+	}
+	if sm.client.Store.ID != nil {
+		ids[sm.client.Store.ID.ToNonAD().String()] = true
+	}
+	if !sm.client.Store.LID.IsEmpty() {
+		ids[sm.client.Store.LID.ToNonAD().String()] = true
+	}
+	return ids
+}
+
+// loadGroupMembers fetches the members of a group once, for resolving and
+// completing mentions
+func (sm *SessionManager) loadGroupMembers(chatID string) {
+	if !strings.HasSuffix(chatID, GROUPSUFFIX) || sm.db.HasGroupMembers(chatID) ||
+		sm.client == nil || !sm.client.IsConnected() {
+		return
+	}
+	jid, err := types.ParseJID(chatID)
+	if err != nil {
+		return
+	}
+	info, err := sm.client.GetGroupInfo(context.Background(), jid)
+	if err != nil {
+		return
+	}
+	sm.db.SetGroupMembers(chatID, participantStrings(info.Participants))
+}
+
+// textMessage builds a text message, mentions in group messages are resolved
+// and sent along so the mentioned members get notified
+func (sm *SessionManager) textMessage(chatID, text string) (*waProto.Message, string) {
+	if !strings.HasSuffix(chatID, GROUPSUFFIX) {
+		return &waProto.Message{Conversation: proto.String(text)}, text
+	}
+	sm.loadGroupMembers(chatID)
+	text, mentioned := sm.db.ResolveMentions(chatID, text)
+	if len(mentioned) == 0 {
+		return &waProto.Message{Conversation: proto.String(text)}, text
+	}
+	return &waProto.Message{
+		ExtendedTextMessage: &waProto.ExtendedTextMessage{
+			Text:        proto.String(text),
+			ContextInfo: &waProto.ContextInfo{MentionedJID: mentioned},
+		},
+	}, text
+}
+
+// jidUser returns the user part of an id, the number for phone users
+func jidUser(id string) string {
+	return strings.SplitN(id, "@", 2)[0]
+}
+
+func isNumber(text string) bool {
+	for _, letter := range text {
+		if !unicode.IsDigit(letter) {
+			return false
+		}
+	}
+	return text != ""
+}
@@ -0,0 +1,75 @@
+package messages
+
+import (
+	"testing"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestResolveMentions(t *testing.T) {
+	db := &MessageDatabase{}
+	db.Init()
+	group := "333@g.us"
+	db.AddContact(Contact{Id: "111@s.whatsapp.net", Name: "Alice Smith", Short: "Alice"})
+	db.AddContact(Contact{Id: "222@s.whatsapp.net", Name: "Bob Jones", Short: "Bob"})
+	db.AddContact(Contact{Id: "444@s.whatsapp.net", Name: "Bob Miller", Short: "Bobby"})
+	db.SetGroupMembers(group, []string{"111@s.whatsapp.net", "222@s.whatsapp.net", "444@s.whatsapp.net"})
+
+	text, mentioned := db.ResolveMentions(group, "@alice and @Bob, mail@alice @nobody @alice")
+	if text != "@111 and @222, mail@alice @nobody @111" {
+		t.Fatalf("unexpected text: %q", text)
+	}
+	if len(mentioned) != 2 || mentioned[0] != "111@s.whatsapp.net" || mentioned[1] != "222@s.whatsapp.net" {
+		t.Fatalf("unexpected mentions: %#v", mentioned)
+	}
+	if text, mentioned = db.ResolveMentions(group, "hi @BobMiller @4912345678"); text != "hi @444 @4912345678" || len(mentioned) != 2 {
+		t.Fatalf("unexpected resolution: %q %#v", text, mentioned)
+	}
+}
+
+func TestTextMessageMentions(t *testing.T) {
+	sm := &SessionManager{}
+	sm.Init(nil)
+	group := "333@g.us"
+	sm.db.AddContact(Contact{Id: "111@s.whatsapp.net", Name: "Alice", Short: "Alice"})
+	sm.db.AddMessage(Message{Id: "1", ChatId: group, SenderId: "111@s.whatsapp.net", Timestamp: 1, Text: "hi"}, false)
+
+	raw, text := sm.textMessage(group, "hey @alice")
+	if text != "hey @111" || raw.GetExtendedTextMessage().GetContextInfo().GetMentionedJID()[0] != "111@s.whatsapp.net" {
+		t.Fatalf("unexpected message: %v", raw)
+	}
+	if raw, _ = sm.textMessage("111@s.whatsapp.net", "hey @alice"); raw.GetConversation() != "hey @alice" {
+		t.Fatalf("expected plain text outside of groups: %v", raw)
+	}
+}
+
+func TestIncomingMentionMarksChat(t *testing.T) {
+	sm := &SessionManager{}
+	sm.Init(nil)
+	sm.db.AddContact(Contact{Id: "111@s.whatsapp.net", Name: "Alice", Short: "Alice"})
+	group := types.NewJID("333", types.GroupServer)
+	info := types.MessageInfo{
+		MessageSource: types.MessageSource{Chat: group, Sender: types.NewJID("222", types.DefaultUserServer), IsGroup: true},
+		ID:            "m1",
+	}
+	raw := &waProto.Message{ExtendedTextMessage: &waProto.ExtendedTextMessage{
+		Text:        proto.String("hi @111"),
+		ContextInfo: &waProto.ContextInfo{MentionedJID: []string{"111@s.whatsapp.net"}},
+	}}
+	msg, ok := sm.eventHandler.messageFromInfo(info, raw)
+	if !ok || len(msg.Mentions) != 1 || msg.Mentions[0].Name != "Alice" || msg.MentionsMe {
+		t.Fatalf("unexpected mentions: %#v", msg.Mentions)
+	}
+
+	msg.MentionsMe = true
+	sm.db.AddMessage(msg, true)
+	if chats := sm.db.GetChatIds(); len(chats) != 1 || !chats[0].Mentioned {
+		t.Fatalf("expected chat to be marked: %#v", chats)
+	}
+	sm.db.MarkChatRead(group.String())
+	if chats := sm.db.GetChatIds(); chats[0].Mentioned {
+		t.Fatal("expected mark to be cleared when read")
+	}
+}
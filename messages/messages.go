@@ -1,4 +1,4 @@
-//this package manages the messages
+// this package manages the messages
 package messages
 
 import (
@@ -11,6 +11,7 @@ import (
 type UiMessageHandler interface {
 	NewMessage(Message)
 	NewScreen([]Message)
+	SearchResults(string, []Message)
 	SetChats([]Chat)
 	PrintError(error)
 	PrintText(string)
@@ -20,6 +21,13 @@ type UiMessageHandler interface {
 	GetWriter() io.Writer
 }
 
+// QRCodePrinter can be implemented by a UiMessageHandler that shows the
+// login QR code itself instead of getting it through GetWriter, the code
+// is passed as text with ANSI colors
+type QRCodePrinter interface {
+	PrintQRCode(string)
+}
+
 // data struct for current session status
 type SessionStatus struct {
 	BatteryCharge    int
@@ -27,6 +35,7 @@ type SessionStatus struct {
 	BatteryPowersave bool
 	Connected        bool
 	LastSeen         string
+	ChatPresence     string // typing or online state of the current chat
 }
 
 // message struct for battery messages
@@ -48,6 +57,12 @@ type Command struct {
 	Params []string
 }
 
+// a command whose caller waits for it, Done is closed once the command ran
+type CommandRequest struct {
+	Command
+	Done chan struct{}
+}
+
 type MessageKind string
 
 const (
@@ -55,7 +70,13 @@ const (
 	MessageKindImage    MessageKind = "image"
 	MessageKindVideo    MessageKind = "video"
 	MessageKindAudio    MessageKind = "audio"
+	MessageKindVoice    MessageKind = "voice" // a recorded voice note
 	MessageKindDocument MessageKind = "document"
+	MessageKindSticker  MessageKind = "sticker"
+	MessageKindLocation MessageKind = "location" // a location pin or live location
+	MessageKindContact  MessageKind = "contact"  // one or more shared contact cards
+	MessageKindPoll     MessageKind = "poll"     // a question with options to vote on
+	MessageKindSystem   MessageKind = "system"   // a change of the chat, like a new subject
 	MessageKindUnknown  MessageKind = "unknown"
 )
 
@@ -75,7 +96,67 @@ type Message struct {
 	MimeType     string
 	FileName     string
 	Unread       bool
-	RawMessage   *waProto.Message
+	QuotedId     string // the message this one replies to
+	QuotedName   string
+	QuotedText   string
+	Edits        []MessageEdit // previous versions, oldest first
+	EditedAt     uint64
+	Pending      bool             // waiting in the outbox
+	SendFailed   bool             // the outbox gave up sending
+	Imported     bool             // read-only message from a chat export
+	LocalPath    string           // attachment file of an imported message
+	Mentions     []Mention        // users mentioned in the text as @number
+	MentionsMe   bool             // one of the mentions is us
+	Reactions    []Reaction       `json:"-"`
+	Receipts     []Receipt        `json:"-"`
+	Recipients   int              `json:"-"` // group members the message went to, 0 if unknown
+	PollVotes    []PollVote       `json:"-"`
+	RawMessage   *waProto.Message `json:"-"`
+}
+
+// a user mentioned in a message, the text contains @ and the user part of the id
+type Mention struct {
+	Id   string
+	Name string
+}
+
+// a previous version of an edited message
+type MessageEdit struct {
+	Text      string
+	Timestamp uint64
+}
+
+// a reaction of a single sender to a message
+type Reaction struct {
+	SenderId  string
+	Emoji     string
+	Timestamp uint64
+}
+
+// a vote of a single voter on a poll, Options holds the SHA-256 hashes of
+// the chosen option names in hex
+type PollVote struct {
+	VoterId   string
+	Options   []string
+	FromMe    bool
+	Timestamp uint64
+}
+
+// how far an outgoing message got, in order
+type ReceiptState int
+
+const (
+	ReceiptSent ReceiptState = iota
+	ReceiptDelivered
+	ReceiptRead
+	ReceiptPlayed
+)
+
+// the receipt state of an outgoing message for a single recipient
+type Receipt struct {
+	ParticipantId string
+	State         ReceiptState
+	Timestamp     uint64
 }
 
 // internal contact representation to abstract from message lib
@@ -84,6 +165,8 @@ type Chat struct {
 	IsGroup bool
 	Name    string
 	Unread  int
+	// an unread message mentions us
+	Mentioned bool
 	//TODO: convert to uint64
 	LastMessage int64
 }
@@ -0,0 +1,175 @@
+package messages
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net"
+
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+// a message waiting to be sent, it is shown in its chat as pending message with the same id
+type OutboxEntry struct {
+	Id          string
+	ChatId      string
+	Kind        MessageKind
+	Text        string
+	Path        string // file to upload for media messages
+	Seconds     uint32 // duration of voice notes
+	Waveform    []byte // loudness of voice notes, 64 values from 0 to 100
+	Created     int64
+	Attempts    int
+	NextAttempt int64 // unix time of the next retry
+	LastError   string
+	Failed      bool             // no more automatic retries
+	Raw         *waProto.Message `json:"-"` // message to send for messages without attachment
+}
+
+// retryable returns true for errors of the connection, sending again later
+// can work. Other errors like an invalid chat or a missing file stay.
+func retryable(err error) bool {
+	var disconnected *whatsmeow.DisconnectedError
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	return errors.Is(err, whatsmeow.ErrNotConnected) || errors.Is(err, whatsmeow.ErrIQTimedOut) ||
+		errors.Is(err, whatsmeow.ErrMessageTimedOut) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.As(err, &disconnected) || errors.As(err, &opErr) || errors.As(err, &dnsErr) ||
+		(errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// AddOutboxEntry queues a message for sending.
+func (md *MessageDatabase) AddOutboxEntry(entry OutboxEntry) {
+	md.messageLock.Lock()
+	defer md.messageLock.Unlock()
+	md.outbox = append(md.outbox, entry)
+	md.persistOutboxEntry(entry)
+}
+
+// GetOutbox returns the queued messages, oldest first.
+func (md *MessageDatabase) GetOutbox() []OutboxEntry {
+	md.messageLock.RLock()
+	defer md.messageLock.RUnlock()
+	out := make([]OutboxEntry, len(md.outbox))
+	copy(out, md.outbox)
+	return out
+}
+
+// GetOutboxEntry returns a single queued message by id.
+func (md *MessageDatabase) GetOutboxEntry(id string) (OutboxEntry, bool) {
+	md.messageLock.RLock()
+	defer md.messageLock.RUnlock()
+	for _, entry := range md.outbox {
+		if entry.Id == id {
+			return entry, true
+		}
+	}
+	return OutboxEntry{}, false
+}
+
+// HasPendingOutbox returns true if a chat has queued messages that will be retried.
+func (md *MessageDatabase) HasPendingOutbox(chatID string) bool {
+	md.messageLock.RLock()
+	defer md.messageLock.RUnlock()
+	for _, entry := range md.outbox {
+		if entry.ChatId == chatID && !entry.Failed {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateOutboxEntry replaces a queued message and updates the state of its pending message.
+func (md *MessageDatabase) UpdateOutboxEntry(entry OutboxEntry) bool {
+	md.messageLock.Lock()
+	defer md.messageLock.Unlock()
+	for idx := range md.outbox {
+		if md.outbox[idx].Id == entry.Id {
+			md.outbox[idx] = entry
+			md.persistOutboxEntry(entry)
+			if msg, ok := md.messagesById[entry.Id]; ok && msg.SendFailed != entry.Failed {
+				msg.SendFailed = entry.Failed
+				md.messagesById[msg.Id] = msg
+				md.replaceMessageLocked(msg)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveOutboxEntry removes a message from the queue, its pending message is kept.
+func (md *MessageDatabase) RemoveOutboxEntry(id string) bool {
+	md.messageLock.Lock()
+	defer md.messageLock.Unlock()
+	for idx := range md.outbox {
+		if md.outbox[idx].Id == id {
+			md.outbox = append(md.outbox[:idx], md.outbox[idx+1:]...)
+			md.deleteOutboxEntry(id)
+			return true
+		}
+	}
+	return false
+}
+
+func (md *MessageDatabase) loadOutbox(store *sql.DB) error {
+	rows, err := store.Query("SELECT data, raw FROM outbox ORDER BY created, rowid")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var data string
+		var raw []byte
+		if err = rows.Scan(&data, &raw); err != nil {
+			return err
+		}
+		var entry OutboxEntry
+		if err = json.Unmarshal([]byte(data), &entry); err != nil {
+			continue
+		}
+		if len(raw) > 0 {
+			rawMsg := &waProto.Message{}
+			if proto.Unmarshal(raw, rawMsg) == nil {
+				entry.Raw = rawMsg
+			}
+		}
+		md.outbox = append(md.outbox, entry)
+	}
+	return rows.Err()
+}
+
+func (md *MessageDatabase) persistOutboxEntry(entry OutboxEntry) {
+	if md.store == nil {
+		return
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		md.reportError(err)
+		return
+	}
+	var raw []byte
+	if entry.Raw != nil {
+		if raw, err = proto.Marshal(entry.Raw); err != nil {
+			raw = nil
+		}
+	}
+	_, err = md.store.Exec(
+		// an upsert keeps the rowid that orders entries created in the same second
+		"INSERT INTO outbox (id, created, data, raw) VALUES (?, ?, ?, ?) ON CONFLICT (id) DO UPDATE SET data = excluded.data, raw = excluded.raw",
+		entry.Id, entry.Created, string(data), raw,
+	)
+	md.reportError(err)
+}
+
+func (md *MessageDatabase) deleteOutboxEntry(id string) {
+	if md.store == nil {
+		return
+	}
+	_, err := md.store.Exec("DELETE FROM outbox WHERE id = ?", id)
+	md.reportError(err)
+}
@@ -0,0 +1,97 @@
+package messages
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestOutboxIsPersistedInOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "messages.db")
+	db := &MessageDatabase{}
+	if err := db.Open(path); err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	db.AddMessage(Message{Id: "out-1", ChatId: "123@s.whatsapp.net", Timestamp: 10, FromMe: true, Text: "first", Pending: true}, false)
+	db.AddOutboxEntry(OutboxEntry{Id: "out-1", ChatId: "123@s.whatsapp.net", Kind: MessageKindText, Text: "first", Created: 10,
+		Raw: &waProto.Message{Conversation: proto.String("first")}})
+	db.AddOutboxEntry(OutboxEntry{Id: "out-2", ChatId: "123@s.whatsapp.net", Kind: MessageKindImage, Path: "/tmp/a.jpg", Created: 10})
+	db.UpdateOutboxEntry(OutboxEntry{Id: "out-1", ChatId: "123@s.whatsapp.net", Kind: MessageKindText, Text: "first", Created: 10,
+		Attempts: 6, Failed: true, Raw: &waProto.Message{Conversation: proto.String("first")}})
+	if !db.HasPendingOutbox("123@s.whatsapp.net") {
+		t.Fatal("expected the second entry to be pending")
+	}
+	db.Close()
+
+	db = &MessageDatabase{}
+	if err := db.Open(path); err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer db.Close()
+	entries := db.GetOutbox()
+	if len(entries) != 2 || entries[0].Id != "out-1" || entries[1].Path != "/tmp/a.jpg" {
+		t.Fatalf("unexpected outbox: %#v", entries)
+	}
+	if !entries[0].Failed || entries[0].Raw.GetConversation() != "first" {
+		t.Fatalf("unexpected first entry: %#v", entries[0])
+	}
+	if msg, _ := db.GetMessage("out-1"); !msg.SendFailed || !msg.Pending {
+		t.Fatalf("expected pending message to be marked as failed: %#v", msg)
+	}
+
+	db.RemoveOutboxEntry("out-2")
+	if db.HasPendingOutbox("123@s.whatsapp.net") {
+		t.Fatal("expected no pending entries after removing the second entry")
+	}
+	db.DeleteMessage("out-1")
+	if msgs := db.GetMessages("123@s.whatsapp.net"); len(msgs) != 0 {
+		t.Fatalf("expected deleted message to be gone, got %#v", msgs)
+	}
+}
+
+func TestOutboxDelayBacksOff(t *testing.T) {
+	if outboxDelay(1) != outboxBaseDelay || outboxDelay(3) != 4*outboxBaseDelay {
+		t.Fatalf("unexpected delays: %v %v", outboxDelay(1), outboxDelay(3))
+	}
+	if outboxDelay(100) != outboxMaxDelay {
+		t.Fatalf("expected delay to be capped, got %v", outboxDelay(100))
+	}
+}
+
+func TestOnlyConnectionErrorsAreRetried(t *testing.T) {
+	for _, err := range []error{
+		fmt.Errorf("failed to send message: %w", whatsmeow.ErrNotConnected),
+		fmt.Errorf("failed to upload file: %w", &net.OpError{Op: "dial", Err: errors.New("connection refused")}),
+		fmt.Errorf("failed to send message: %w", whatsmeow.ErrMessageTimedOut),
+		whatsmeow.ErrIQDisconnected,
+	} {
+		if !retryable(err) {
+			t.Fatalf("expected %v to be retried", err)
+		}
+	}
+	if retryable(fmt.Errorf("failed to send message: %w", whatsmeow.ErrUnknownServer)) {
+		t.Fatal("expected an unknown server not to be retried")
+	}
+
+	sm := &SessionManager{}
+	sm.Init(nil)
+	for _, entry := range []OutboxEntry{
+		{Id: "out-1", ChatId: "not a jid@", Kind: MessageKindText, Raw: &waProto.Message{Conversation: proto.String("hi")}},
+		{Id: "out-2", ChatId: "123@s.whatsapp.net", Kind: MessageKindImage, Path: filepath.Join(t.TempDir(), "missing.jpg")},
+	} {
+		_, err := sm.deliver(entry)
+		if err == nil || retryable(err) {
+			t.Fatalf("expected %s to fail for good, got %v", entry.Id, err)
+		}
+		if entry.Path != "" && !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
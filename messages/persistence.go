@@ -0,0 +1,347 @@
+package messages
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+const messageStoreSchema = `
+CREATE TABLE IF NOT EXISTS messages (
+	id        TEXT PRIMARY KEY,
+	chat_id   TEXT NOT NULL,
+	timestamp INTEGER NOT NULL,
+	data      TEXT NOT NULL,
+	raw       BLOB
+);
+CREATE INDEX IF NOT EXISTS messages_chat_idx ON messages (chat_id, timestamp);
+CREATE TABLE IF NOT EXISTS chats (
+	id           TEXT PRIMARY KEY,
+	is_group     INTEGER NOT NULL,
+	name         TEXT NOT NULL,
+	unread       INTEGER NOT NULL,
+	last_message INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS contacts (
+	id    TEXT PRIMARY KEY,
+	name  TEXT NOT NULL,
+	short TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS reactions (
+	message_id TEXT NOT NULL,
+	sender_id  TEXT NOT NULL,
+	emoji      TEXT NOT NULL,
+	timestamp  INTEGER NOT NULL,
+	PRIMARY KEY (message_id, sender_id)
+);
+CREATE TABLE IF NOT EXISTS receipts (
+	message_id     TEXT NOT NULL,
+	participant_id TEXT NOT NULL,
+	state          INTEGER NOT NULL,
+	timestamp      INTEGER NOT NULL,
+	PRIMARY KEY (message_id, participant_id)
+);
+CREATE TABLE IF NOT EXISTS poll_votes (
+	message_id TEXT NOT NULL,
+	voter_id   TEXT NOT NULL,
+	options    TEXT NOT NULL,
+	from_me    INTEGER NOT NULL,
+	timestamp  INTEGER NOT NULL,
+	PRIMARY KEY (message_id, voter_id)
+);
+CREATE TABLE IF NOT EXISTS outbox (
+	id      TEXT PRIMARY KEY,
+	created INTEGER NOT NULL,
+	data    TEXT NOT NULL,
+	raw     BLOB
+);
+`
+
+// Open initializes the message database and backs it with the SQLite file at path.
+// Previously stored chats, contacts and messages are loaded into memory.
+func (md *MessageDatabase) Open(path string) error {
+	md.Init()
+	store, err := sql.Open("sqlite3", "file:"+path+"?_journal_mode=WAL&_synchronous=NORMAL&_busy_timeout=5000")
+	if err != nil {
+		return fmt.Errorf("failed to open message store: %v", err)
+	}
+	if _, err = store.Exec(messageStoreSchema); err != nil {
+		store.Close()
+		return fmt.Errorf("failed to create message store: %v", err)
+	}
+	if err = md.loadStore(store); err != nil {
+		store.Close()
+		md.Init()
+		return fmt.Errorf("failed to load message store: %v", err)
+	}
+	md.store = store
+	return nil
+}
+
+// Close closes the backing store, if any.
+func (md *MessageDatabase) Close() error {
+	if md.store == nil {
+		return nil
+	}
+	err := md.store.Close()
+	md.store = nil
+	return err
+}
+
+// Clear removes all chats, contacts and messages, including the persisted ones.
+func (md *MessageDatabase) Clear() error {
+	md.messageLock.Lock()
+	md.chatLock.Lock()
+	md.contactLock.Lock()
+	md.messages = make(map[string][]Message)
+	md.messagesById = make(map[string]Message)
+	md.chats = make(map[string]Chat)
+	md.contacts = make(map[string]Contact)
+	md.searchIndex = make(map[string]map[string]struct{})
+	md.reactions = make(map[string]map[string]Reaction)
+	md.receipts = make(map[string]map[string]Receipt)
+	md.pollVotes = make(map[string]map[string]PollVote)
+	md.outbox = nil
+	md.contactLock.Unlock()
+	md.chatLock.Unlock()
+	md.messageLock.Unlock()
+
+	if md.store == nil {
+		return nil
+	}
+	_, err := md.store.Exec("DELETE FROM messages; DELETE FROM chats; DELETE FROM contacts; DELETE FROM reactions; DELETE FROM receipts; DELETE FROM poll_votes; DELETE FROM outbox;")
+	return err
+}
+
+func (md *MessageDatabase) loadStore(store *sql.DB) error {
+	chatRows, err := store.Query("SELECT id, is_group, name, unread, last_message FROM chats")
+	if err != nil {
+		return err
+	}
+	for chatRows.Next() {
+		var chat Chat
+		if err = chatRows.Scan(&chat.Id, &chat.IsGroup, &chat.Name, &chat.Unread, &chat.LastMessage); err != nil {
+			chatRows.Close()
+			return err
+		}
+		md.chats[chat.Id] = chat
+	}
+	chatRows.Close()
+
+	contactRows, err := store.Query("SELECT id, name, short FROM contacts")
+	if err != nil {
+		return err
+	}
+	for contactRows.Next() {
+		var contact Contact
+		if err = contactRows.Scan(&contact.Id, &contact.Name, &contact.Short); err != nil {
+			contactRows.Close()
+			return err
+		}
+		md.contacts[contact.Id] = contact
+	}
+	contactRows.Close()
+
+	reactionRows, err := store.Query("SELECT message_id, sender_id, emoji, timestamp FROM reactions")
+	if err != nil {
+		return err
+	}
+	for reactionRows.Next() {
+		var messageID string
+		var reaction Reaction
+		if err = reactionRows.Scan(&messageID, &reaction.SenderId, &reaction.Emoji, &reaction.Timestamp); err != nil {
+			reactionRows.Close()
+			return err
+		}
+		if md.reactions[messageID] == nil {
+			md.reactions[messageID] = make(map[string]Reaction)
+		}
+		md.reactions[messageID][reaction.SenderId] = reaction
+	}
+	reactionRows.Close()
+
+	receiptRows, err := store.Query("SELECT message_id, participant_id, state, timestamp FROM receipts")
+	if err != nil {
+		return err
+	}
+	for receiptRows.Next() {
+		var messageID string
+		var receipt Receipt
+		if err = receiptRows.Scan(&messageID, &receipt.ParticipantId, &receipt.State, &receipt.Timestamp); err != nil {
+			receiptRows.Close()
+			return err
+		}
+		if md.receipts[messageID] == nil {
+			md.receipts[messageID] = make(map[string]Receipt)
+		}
+		md.receipts[messageID][receipt.ParticipantId] = receipt
+	}
+	receiptRows.Close()
+
+	voteRows, err := store.Query("SELECT message_id, voter_id, options, from_me, timestamp FROM poll_votes")
+	if err != nil {
+		return err
+	}
+	for voteRows.Next() {
+		var messageID, options string
+		var vote PollVote
+		if err = voteRows.Scan(&messageID, &vote.VoterId, &options, &vote.FromMe, &vote.Timestamp); err != nil {
+			voteRows.Close()
+			return err
+		}
+		vote.Options = strings.Split(options, ",")
+		if md.pollVotes[messageID] == nil {
+			md.pollVotes[messageID] = make(map[string]PollVote)
+		}
+		md.pollVotes[messageID][vote.VoterId] = vote
+	}
+	voteRows.Close()
+
+	if err = md.loadOutbox(store); err != nil {
+		return err
+	}
+
+	msgRows, err := store.Query("SELECT data, raw FROM messages ORDER BY timestamp, id")
+	if err != nil {
+		return err
+	}
+	defer msgRows.Close()
+	for msgRows.Next() {
+		var data string
+		var raw []byte
+		if err = msgRows.Scan(&data, &raw); err != nil {
+			return err
+		}
+		var msg Message
+		if err = json.Unmarshal([]byte(data), &msg); err != nil {
+			continue
+		}
+		if len(raw) > 0 {
+			rawMsg := &waProto.Message{}
+			if proto.Unmarshal(raw, rawMsg) == nil {
+				msg.RawMessage = rawMsg
+			}
+		}
+		md.messagesById[msg.Id] = msg
+		md.messages[msg.ChatId] = append(md.messages[msg.ChatId], msg)
+		md.indexMessageLocked(msg)
+	}
+	return msgRows.Err()
+}
+
+func (md *MessageDatabase) persistMessage(msg Message) {
+	if md.store == nil {
+		return
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		md.reportError(err)
+		return
+	}
+	var raw []byte
+	if msg.RawMessage != nil {
+		if raw, err = proto.Marshal(msg.RawMessage); err != nil {
+			raw = nil
+		}
+	}
+	_, err = md.store.Exec(
+		"INSERT OR REPLACE INTO messages (id, chat_id, timestamp, data, raw) VALUES (?, ?, ?, ?, ?)",
+		msg.Id, msg.ChatId, int64(msg.Timestamp), string(data), raw,
+	)
+	md.reportError(err)
+}
+
+func (md *MessageDatabase) deleteMessage(messageID string) {
+	if md.store == nil {
+		return
+	}
+	_, err := md.store.Exec("DELETE FROM messages WHERE id = ?", messageID)
+	md.reportError(err)
+	_, err = md.store.Exec("DELETE FROM reactions WHERE message_id = ?", messageID)
+	md.reportError(err)
+	_, err = md.store.Exec("DELETE FROM receipts WHERE message_id = ?", messageID)
+	md.reportError(err)
+	_, err = md.store.Exec("DELETE FROM poll_votes WHERE message_id = ?", messageID)
+	md.reportError(err)
+}
+
+func (md *MessageDatabase) persistChat(chat Chat) {
+	if md.store == nil {
+		return
+	}
+	_, err := md.store.Exec(
+		"INSERT OR REPLACE INTO chats (id, is_group, name, unread, last_message) VALUES (?, ?, ?, ?, ?)",
+		chat.Id, chat.IsGroup, chat.Name, chat.Unread, chat.LastMessage,
+	)
+	md.reportError(err)
+}
+
+func (md *MessageDatabase) persistContact(contact Contact) {
+	if md.store == nil {
+		return
+	}
+	_, err := md.store.Exec(
+		"INSERT OR REPLACE INTO contacts (id, name, short) VALUES (?, ?, ?)",
+		contact.Id, contact.Name, contact.Short,
+	)
+	md.reportError(err)
+}
+
+func (md *MessageDatabase) persistReaction(messageID string, reaction Reaction) {
+	if md.store == nil {
+		return
+	}
+	_, err := md.store.Exec(
+		"INSERT OR REPLACE INTO reactions (message_id, sender_id, emoji, timestamp) VALUES (?, ?, ?, ?)",
+		messageID, reaction.SenderId, reaction.Emoji, int64(reaction.Timestamp),
+	)
+	md.reportError(err)
+}
+
+func (md *MessageDatabase) deleteReaction(messageID, senderID string) {
+	if md.store == nil {
+		return
+	}
+	_, err := md.store.Exec("DELETE FROM reactions WHERE message_id = ? AND sender_id = ?", messageID, senderID)
+	md.reportError(err)
+}
+
+func (md *MessageDatabase) persistPollVote(messageID string, vote PollVote) {
+	if md.store == nil {
+		return
+	}
+	_, err := md.store.Exec(
+		"INSERT OR REPLACE INTO poll_votes (message_id, voter_id, options, from_me, timestamp) VALUES (?, ?, ?, ?, ?)",
+		messageID, vote.VoterId, strings.Join(vote.Options, ","), vote.FromMe, int64(vote.Timestamp),
+	)
+	md.reportError(err)
+}
+
+func (md *MessageDatabase) deletePollVote(messageID, voterID string) {
+	if md.store == nil {
+		return
+	}
+	_, err := md.store.Exec("DELETE FROM poll_votes WHERE message_id = ? AND voter_id = ?", messageID, voterID)
+	md.reportError(err)
+}
+
+func (md *MessageDatabase) persistReceipt(messageID string, receipt Receipt) {
+	if md.store == nil {
+		return
+	}
+	_, err := md.store.Exec(
+		"INSERT OR REPLACE INTO receipts (message_id, participant_id, state, timestamp) VALUES (?, ?, ?, ?)",
+		messageID, receipt.ParticipantId, int(receipt.State), int64(receipt.Timestamp),
+	)
+	md.reportError(err)
+}
+
+func (md *MessageDatabase) reportError(err error) {
+	if err != nil && md.ErrorHandler != nil {
+		md.ErrorHandler(fmt.Errorf("message store: %v", err))
+	}
+}
@@ -0,0 +1,330 @@
+package messages
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// the most options WhatsApp allows in a poll
+const maxPollOptions = 12
+
+// the tally of a single poll option, Mine is set if we chose it
+type PollOption struct {
+	Name  string
+	Votes int
+	Mine  bool
+}
+
+// pollCreation returns the poll of a message, polls come in several versions
+func pollCreation(raw *waProto.Message) *waProto.PollCreationMessage {
+	switch {
+	case raw.GetPollCreationMessage() != nil:
+		return raw.GetPollCreationMessage()
+	case raw.GetPollCreationMessageV2() != nil:
+		return raw.GetPollCreationMessageV2()
+	case raw.GetPollCreationMessageV3() != nil:
+		return raw.GetPollCreationMessageV3()
+	case raw.GetPollCreationMessageV5() != nil:
+		return raw.GetPollCreationMessageV5()
+	case raw.GetPollCreationMessageV6() != nil:
+		return raw.GetPollCreationMessageV6()
+	}
+	return nil
+}
+
+// pollText shows the question of a poll, the options are shown with their
+// counts by the UI
+func pollText(poll *waProto.PollCreationMessage) string {
+	text := "[POLL] " + poll.GetName()
+	if count := poll.GetSelectableOptionsCount(); count != 1 && len(poll.GetOptions()) > 1 {
+		text += " (multiple choice)"
+	}
+	return text
+}
+
+// pollOptionHash returns the hex encoded SHA-256 hash votes use to refer to an option
+func pollOptionHash(name string) string {
+	hash := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(hash[:])
+}
+
+// PollResults returns the options of a poll message with the number of votes
+// each got, in the order of the poll.
+func PollResults(msg Message) []PollOption {
+	poll := pollCreation(msg.RawMessage)
+	if poll == nil {
+		return nil
+	}
+	out := make([]PollOption, 0, len(poll.GetOptions()))
+	index := make(map[string]int)
+	for _, option := range poll.GetOptions() {
+		index[pollOptionHash(option.GetOptionName())] = len(out)
+		out = append(out, PollOption{Name: option.GetOptionName()})
+	}
+	for _, vote := range msg.PollVotes {
+		for _, hash := range vote.Options {
+			if idx, ok := index[hash]; ok {
+				out[idx].Votes++
+				out[idx].Mine = out[idx].Mine || vote.FromMe
+			}
+		}
+	}
+	return out
+}
+
+// pollVoteNames returns the names of the options chosen in a vote
+func pollVoteNames(msg Message, vote PollVote) []string {
+	names := make([]string, 0, len(vote.Options))
+	for _, option := range pollCreation(msg.RawMessage).GetOptions() {
+		for _, hash := range vote.Options {
+			if hash == pollOptionHash(option.GetOptionName()) {
+				names = append(names, option.GetOptionName())
+			}
+		}
+	}
+	return names
+}
+
+// SetPollVote stores the vote of a voter on a poll, replacing any earlier
+// vote of that voter. A vote without options removes the vote.
+// Returns true if the stored votes changed.
+func (md *MessageDatabase) SetPollVote(messageID string, vote PollVote) bool {
+	md.messageLock.Lock()
+	defer md.messageLock.Unlock()
+
+	voters := md.pollVotes[messageID]
+	existing, ok := voters[vote.VoterId]
+	if ok && vote.Timestamp != 0 && vote.Timestamp < existing.Timestamp {
+		return false
+	}
+	if len(vote.Options) == 0 {
+		if !ok {
+			return false
+		}
+		delete(voters, vote.VoterId)
+		if len(voters) == 0 {
+			delete(md.pollVotes, messageID)
+		}
+		md.deletePollVote(messageID, vote.VoterId)
+		return true
+	}
+	if ok && existing.FromMe == vote.FromMe && strings.Join(existing.Options, ",") == strings.Join(vote.Options, ",") {
+		return false
+	}
+	if voters == nil {
+		voters = make(map[string]PollVote)
+		md.pollVotes[messageID] = voters
+	}
+	voters[vote.VoterId] = vote
+	md.persistPollVote(messageID, vote)
+	return true
+}
+
+// GetPollVotes returns the votes on a poll, oldest first.
+func (md *MessageDatabase) GetPollVotes(messageID string) []PollVote {
+	md.messageLock.RLock()
+	defer md.messageLock.RUnlock()
+	return md.pollVotesLocked(messageID)
+}
+
+func (md *MessageDatabase) pollVotesLocked(messageID string) []PollVote {
+	voters := md.pollVotes[messageID]
+	if len(voters) == 0 {
+		return nil
+	}
+	out := make([]PollVote, 0, len(voters))
+	for _, vote := range voters {
+		out = append(out, vote)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Timestamp == out[j].Timestamp {
+			return out[i].VoterId < out[j].VoterId
+		}
+		return out[i].Timestamp < out[j].Timestamp
+	})
+	return out
+}
+
+// pollVote decrypts a poll vote, the selected options stay hashed until they
+// are matched with the options of the poll
+func (eh *eventHandler) pollVote(evt *events.Message) (PollVote, error) {
+	if eh.sm.client == nil {
+		return PollVote{}, errors.New("not connected to WhatsApp")
+	}
+	decrypted, err := eh.sm.client.DecryptPollVote(context.Background(), evt)
+	if err != nil {
+		return PollVote{}, err
+	}
+	timestamp := evt.Info.Timestamp.Unix()
+	if ms := evt.Message.GetPollUpdateMessage().GetSenderTimestampMS(); ms > 0 {
+		timestamp = ms / 1000
+	}
+	vote := PollVote{
+		VoterId:   evt.Info.Sender.ToNonAD().String(),
+		FromMe:    evt.Info.IsFromMe,
+		Timestamp: uint64(timestamp),
+	}
+	for _, hash := range decrypted.GetSelectedOptions() {
+		vote.Options = append(vote.Options, hex.EncodeToString(hash))
+	}
+	return vote, nil
+}
+
+// pollCommand creates a poll in the current chat
+func (sm *SessionManager) pollCommand(params []string) {
+	if sm.currentReceiver == "" {
+		sm.printCommandUsage("poll", "-> only works in a chat")
+		return
+	}
+	if !checkParam(params, 2) {
+		sm.printCommandUsage("poll", "\"Question\" option | option [| option…[]")
+		return
+	}
+	question, options, err := parsePoll(strings.Join(params, " "))
+	if err != nil {
+		sm.uiHandler.PrintError(err)
+		return
+	}
+	if sm.client == nil {
+		sm.uiHandler.PrintError(errors.New("not connected to WhatsApp"))
+		return
+	}
+	raw := sm.client.BuildPollCreation(question, options, 1)
+	sm.uiHandler.PrintError(sm.sendOrQueue(OutboxEntry{
+		ChatId: sm.currentReceiver,
+		Kind:   MessageKindPoll,
+		Text:   pollText(raw.GetPollCreationMessage()),
+		Raw:    raw,
+	}))
+}
+
+// parsePoll reads a question in double quotes followed by options separated
+// by |
+func parsePoll(text string) (string, []string, error) {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "\"") {
+		return "", nil, errors.New("the question has to be in double quotes")
+	}
+	end := strings.Index(text[1:], "\"")
+	if end < 0 {
+		return "", nil, errors.New("the question is missing its closing quote")
+	}
+	question := strings.TrimSpace(text[1 : end+1])
+	if question == "" {
+		return "", nil, errors.New("the question is empty")
+	}
+	options := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, option := range strings.Split(text[end+2:], "|") {
+		option = strings.TrimSpace(option)
+		if option == "" {
+			continue
+		}
+		if seen[option] {
+			return "", nil, fmt.Errorf("option %q is given twice", option)
+		}
+		seen[option] = true
+		options = append(options, option)
+	}
+	if len(options) < 2 || len(options) > maxPollOptions {
+		return "", nil, fmt.Errorf("a poll needs 2 to %d options", maxPollOptions)
+	}
+	return question, options, nil
+}
+
+// voteCommand votes on a poll with the numbers of the chosen options
+func (sm *SessionManager) voteCommand(params []string) {
+	if !checkParam(params, 1) {
+		sm.printCommandUsage("vote", "[message-id[] [option-number…[] -> without options removes the vote")
+		return
+	}
+	if sm.client == nil || !sm.client.IsConnected() {
+		sm.uiHandler.PrintError(errors.New("not connected to WhatsApp"))
+		return
+	}
+	msg, err := sm.getRemoteMessage(params[0])
+	if err != nil {
+		sm.uiHandler.PrintError(err)
+		return
+	}
+	poll := pollCreation(msg.RawMessage)
+	if poll == nil {
+		sm.uiHandler.PrintError(errors.New("this is not a poll"))
+		return
+	}
+	names, err := pollChoices(poll, params[1:])
+	if err != nil {
+		sm.uiHandler.PrintError(err)
+		return
+	}
+	chatJID, err := types.ParseJID(msg.ChatId)
+	if err != nil {
+		sm.uiHandler.PrintError(fmt.Errorf("invalid chat JID: %v", err))
+		return
+	}
+	info := &types.MessageInfo{
+		MessageSource: types.MessageSource{
+			Chat:     chatJID,
+			Sender:   messageSender(msg),
+			IsFromMe: msg.FromMe,
+			IsGroup:  chatJID.Server == types.GroupServer,
+		},
+		ID: types.MessageID(msg.Id),
+	}
+	raw, err := sm.client.BuildPollVote(context.Background(), info, names)
+	if err != nil {
+		sm.uiHandler.PrintError(err)
+		return
+	}
+	resp, err := sm.client.SendMessage(context.Background(), chatJID, raw)
+	if err != nil {
+		sm.uiHandler.PrintError(fmt.Errorf("failed to send vote: %v", err))
+		return
+	}
+	vote := PollVote{
+		VoterId:   sm.selfID(),
+		FromMe:    true,
+		Timestamp: uint64(resp.Timestamp.Unix()),
+	}
+	for _, name := range names {
+		vote.Options = append(vote.Options, pollOptionHash(name))
+	}
+	if sm.db.SetPollVote(msg.Id, vote) && sm.currentReceiver == msg.ChatId {
+		sm.uiHandler.NewScreen(sm.GetMessages(msg.ChatId))
+	}
+}
+
+// pollChoices returns the names of the options with the given numbers,
+// counting from 1 as shown in the chat
+func pollChoices(poll *waProto.PollCreationMessage, numbers []string) ([]string, error) {
+	options := poll.GetOptions()
+	names := make([]string, 0, len(numbers))
+	seen := make(map[int]bool)
+	for _, number := range numbers {
+		if number == "" {
+			continue
+		}
+		idx, err := strconv.Atoi(number)
+		if err != nil || idx < 1 || idx > len(options) {
+			return nil, fmt.Errorf("option must be a number from 1 to %d", len(options))
+		}
+		if !seen[idx] {
+			seen[idx] = true
+			names = append(names, options[idx-1].GetOptionName())
+		}
+	}
+	if count := int(poll.GetSelectableOptionsCount()); count > 0 && len(names) > count {
+		return nil, fmt.Errorf("only %d option(s) can be chosen", count)
+	}
+	return names, nil
+}
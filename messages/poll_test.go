@@ -0,0 +1,116 @@
+package messages
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/proto/waCommon"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestParsePoll(t *testing.T) {
+	question, options, err := parsePoll(`"Lunch today?" Pizza | Sushi  |Salad|`)
+	if err != nil || question != "Lunch today?" || !reflect.DeepEqual(options, []string{"Pizza", "Sushi", "Salad"}) {
+		t.Fatalf("unexpected poll: %q %q %v", question, options, err)
+	}
+	for _, text := range []string{`Lunch? Pizza | Sushi`, `"Lunch? Pizza | Sushi`, `"Lunch?" Pizza`, `"Lunch?" Pizza | Pizza`} {
+		if _, _, err = parsePoll(text); err == nil {
+			t.Fatalf("expected %q to fail", text)
+		}
+	}
+}
+
+func TestPollVotes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "messages.db")
+	sm := &SessionManager{}
+	sm.Init(nil)
+	if err := sm.db.Open(path); err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	info := types.MessageInfo{
+		MessageSource: types.MessageSource{Chat: types.NewJID("group", types.GroupServer), Sender: types.NewJID("111", types.DefaultUserServer), IsGroup: true},
+		ID:            "poll-1",
+	}
+	raw := &waProto.Message{PollCreationMessageV3: &waProto.PollCreationMessage{
+		Name: proto.String("Lunch?"),
+		Options: []*waProto.PollCreationMessage_Option{
+			{OptionName: proto.String("Pizza")}, {OptionName: proto.String("Sushi")},
+		},
+		SelectableOptionsCount: proto.Uint32(1),
+	}}
+	msg, ok := sm.eventHandler.messageFromInfo(info, raw)
+	if !ok || msg.Kind != MessageKindPoll || msg.Text != "[POLL] Lunch?" {
+		t.Fatalf("unexpected message: %#v", msg)
+	}
+	sm.db.AddMessage(msg, false)
+
+	pizza, sushi := pollOptionHash("Pizza"), pollOptionHash("Sushi")
+	sm.db.SetPollVote("poll-1", PollVote{VoterId: "a@s.whatsapp.net", Options: []string{pizza}, Timestamp: 2})
+	sm.db.SetPollVote("poll-1", PollVote{VoterId: "me@s.whatsapp.net", Options: []string{sushi}, FromMe: true, Timestamp: 3})
+	if !sm.db.SetPollVote("poll-1", PollVote{VoterId: "a@s.whatsapp.net", Options: []string{sushi}, Timestamp: 4}) {
+		t.Fatal("expected changed vote to be stored")
+	}
+	if sm.db.SetPollVote("poll-1", PollVote{VoterId: "a@s.whatsapp.net", Options: []string{pizza}, Timestamp: 1}) {
+		t.Fatal("expected older vote to be ignored")
+	}
+	msg, _ = sm.db.GetMessage("poll-1")
+	expected := []PollOption{{Name: "Pizza"}, {Name: "Sushi", Votes: 2, Mine: true}}
+	if results := PollResults(msg); !reflect.DeepEqual(results, expected) {
+		t.Fatalf("unexpected results: %#v", results)
+	}
+	sm.db.Close()
+
+	if err := sm.db.Open(path); err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer sm.db.Close()
+	if !sm.db.SetPollVote("poll-1", PollVote{VoterId: "me@s.whatsapp.net", Timestamp: 5}) {
+		t.Fatal("expected empty vote to remove the vote")
+	}
+	msgs := sm.db.GetMessages(info.Chat.String())
+	if results := PollResults(msgs[0]); results[1].Votes != 1 || results[1].Mine {
+		t.Fatalf("unexpected results after reopen: %#v", results)
+	}
+}
+
+func TestPollChoices(t *testing.T) {
+	poll := &waProto.PollCreationMessage{
+		Options: []*waProto.PollCreationMessage_Option{
+			{OptionName: proto.String("Pizza")}, {OptionName: proto.String("Sushi")}, {OptionName: proto.String("Salad")},
+		},
+	}
+	names, err := pollChoices(poll, []string{"3", "1", "3"})
+	if err != nil || !reflect.DeepEqual(names, []string{"Salad", "Pizza"}) {
+		t.Fatalf("unexpected choices: %q %v", names, err)
+	}
+	if _, err = pollChoices(poll, []string{"4"}); err == nil {
+		t.Fatal("expected unknown option to fail")
+	}
+	poll.SelectableOptionsCount = proto.Uint32(1)
+	if _, err = pollChoices(poll, []string{"1", "2"}); err == nil {
+		t.Fatal("expected too many options to fail")
+	}
+}
+
+func TestVoteOnUnknownPollIsDropped(t *testing.T) {
+	ui := &errorUi{}
+	sm := &SessionManager{}
+	sm.Init(ui)
+	group := types.NewJID("group", types.GroupServer)
+	sm.eventHandler.Handle(&events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: group, Sender: types.NewJID("111", types.DefaultUserServer), IsGroup: true},
+			ID:            "vote-1",
+		},
+		Message: &waProto.Message{PollUpdateMessage: &waProto.PollUpdateMessage{
+			PollCreationMessageKey: &waCommon.MessageKey{ID: proto.String("old-poll")},
+		}},
+	})
+	if len(ui.errors) != 0 {
+		t.Fatalf("expected the vote to be dropped quietly, got %v", ui.errors)
+	}
+}
@@ -0,0 +1,157 @@
+package messages
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/normen/whatscli/config"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// typing notifications are dropped after this time if no paused state arrives
+const typingTimeout = 25 * time.Second
+
+// the typing state of a sender in a chat
+type chatState struct {
+	media types.ChatPresenceMedia
+	since time.Time
+}
+
+// the online state of a contact
+type contactPresence struct {
+	online   bool
+	lastSeen time.Time
+}
+
+// handlePresence updates the typing and online state from a presence event,
+// a nil event only refreshes the status to drop expired typing states
+func (sm *SessionManager) handlePresence(evt interface{}) {
+	switch v := evt.(type) {
+	case *events.ChatPresence:
+		chatID := v.Chat.ToNonAD().String()
+		senderID := v.Sender.ToNonAD().String()
+		if v.State == types.ChatPresenceComposing {
+			if sm.chatStates[chatID] == nil {
+				sm.chatStates[chatID] = make(map[string]chatState)
+			}
+			sm.chatStates[chatID][senderID] = chatState{media: v.Media, since: time.Now()}
+			time.AfterFunc(typingTimeout, func() {
+				sm.queuePresence(nil)
+			})
+			// someone who types is online
+			presence := sm.presences[senderID]
+			presence.online = true
+			sm.presences[senderID] = presence
+		} else {
+			delete(sm.chatStates[chatID], senderID)
+		}
+	case *events.Presence:
+		userID := v.From.ToNonAD().String()
+		presence := contactPresence{online: !v.Unavailable, lastSeen: v.LastSeen}
+		if presence.lastSeen.IsZero() {
+			presence.lastSeen = sm.presences[userID].lastSeen
+		}
+		sm.presences[userID] = presence
+		if v.Unavailable {
+			for _, states := range sm.chatStates {
+				delete(states, userID)
+			}
+		}
+	}
+	sm.updateChatPresence()
+}
+
+// updateChatPresence shows the typing or online state of the current chat in the status
+func (sm *SessionManager) updateChatPresence() {
+	text := sm.chatPresenceText(sm.currentReceiver)
+	if text == sm.statusInfo.ChatPresence {
+		return
+	}
+	sm.statusInfo.ChatPresence = text
+	sm.uiHandler.SetStatus(sm.statusInfo)
+}
+
+func (sm *SessionManager) chatPresenceText(chatID string) string {
+	if chatID == "" {
+		return ""
+	}
+	isGroup := strings.HasSuffix(chatID, GROUPSUFFIX)
+	typing := make([]string, 0)
+	recording := false
+	for senderID, state := range sm.chatStates[chatID] {
+		if time.Since(state.since) > typingTimeout {
+			delete(sm.chatStates[chatID], senderID)
+			continue
+		}
+		typing = append(typing, sm.db.GetIdShort(senderID))
+		recording = recording || state.media == types.ChatPresenceMediaAudio
+	}
+	if len(typing) > 0 {
+		action := "typing…"
+		if recording {
+			action = "recording…"
+		}
+		if !isGroup {
+			return action
+		}
+		return strings.Join(typing, ", ") + " " + action
+	}
+	if isGroup {
+		return ""
+	}
+	presence, ok := sm.presences[chatID]
+	switch {
+	case !ok:
+		return ""
+	case presence.online:
+		return "online"
+	case !presence.lastSeen.IsZero():
+		return "last seen " + presence.lastSeen.Format("02-01-06 15:04")
+	}
+	return ""
+}
+
+// announcePresence marks us as online so we receive typing notifications,
+// and subscribes to the online state of the current chat
+func (sm *SessionManager) announcePresence() {
+	if !config.Config.General.SharePresence || sm.client == nil || !sm.client.IsConnected() {
+		return
+	}
+	if err := sm.client.SendPresence(context.Background(), types.PresenceAvailable); err != nil {
+		sm.uiHandler.PrintError(err)
+		return
+	}
+	sm.subscribePresence(sm.currentReceiver)
+}
+
+func (sm *SessionManager) subscribePresence(chatID string) {
+	if !config.Config.General.SharePresence || chatID == "" || strings.HasSuffix(chatID, GROUPSUFFIX) ||
+		sm.client == nil || !sm.client.IsConnected() {
+		return
+	}
+	if jid, err := types.ParseJID(chatID); err == nil {
+		sm.client.SubscribePresence(context.Background(), jid)
+	}
+}
+
+// sendTyping sends our typing state to a chat, unless sharing presence is disabled
+func (sm *SessionManager) sendTyping(params []string) {
+	if !checkParam(params, 2) {
+		sm.printCommandUsage("typing", "[chat-id[] [composing|paused[]")
+		return
+	}
+	if !config.Config.General.SharePresence || sm.client == nil || !sm.client.IsConnected() {
+		return
+	}
+	jid, err := types.ParseJID(params[0])
+	if err != nil {
+		return
+	}
+	state := types.ChatPresencePaused
+	if params[1] == "composing" {
+		state = types.ChatPresenceComposing
+	}
+	sm.client.SendChatPresence(context.Background(), jid, state, types.ChatPresenceMediaText)
+}
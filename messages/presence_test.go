@@ -0,0 +1,56 @@
+package messages
+
+import (
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func TestChatPresenceText(t *testing.T) {
+	sm := &SessionManager{}
+	sm.Init(nil)
+	alice := types.NewJID("111", types.DefaultUserServer)
+	bob := types.NewJID("222", types.DefaultUserServer)
+	group := types.NewJID("333", types.GroupServer)
+	sm.db.AddContact(Contact{Id: alice.String(), Name: "Alice", Short: "Alice"})
+	sm.db.AddContact(Contact{Id: bob.String(), Name: "Bob", Short: "Bob"})
+
+	sm.presences[alice.String()] = contactPresence{lastSeen: time.Date(2026, 10, 17, 15, 4, 0, 0, time.Local)}
+	if text := sm.chatPresenceText(alice.String()); text != "last seen 17-10-26 15:04" {
+		t.Fatalf("unexpected presence: %q", text)
+	}
+
+	sm.chatStates[group.String()] = map[string]chatState{
+		alice.String(): {since: time.Now()},
+		bob.String():   {since: time.Now().Add(-time.Minute)},
+	}
+	if text := sm.chatPresenceText(group.String()); text != "Alice typing…" {
+		t.Fatalf("expected expired typing state to be dropped, got %q", text)
+	}
+
+	sm.chatStates[alice.String()] = map[string]chatState{
+		alice.String(): {media: types.ChatPresenceMediaAudio, since: time.Now()},
+	}
+	if text := sm.chatPresenceText(alice.String()); text != "recording…" {
+		t.Fatalf("unexpected presence: %q", text)
+	}
+}
+
+func TestPresenceKeepsLastSeen(t *testing.T) {
+	sm := &SessionManager{}
+	sm.Init(nil)
+	alice := types.NewJID("111", types.DefaultUserServer)
+	lastSeen := time.Date(2026, 10, 17, 15, 4, 0, 0, time.Local)
+
+	sm.handlePresence(&events.Presence{From: alice, Unavailable: true, LastSeen: lastSeen})
+	sm.handlePresence(&events.Presence{From: alice})
+	if text := sm.chatPresenceText(alice.String()); text != "online" {
+		t.Fatalf("expected online, got %q", text)
+	}
+	sm.handlePresence(&events.Presence{From: alice, Unavailable: true})
+	if sm.presences[alice.String()].lastSeen != lastSeen {
+		t.Fatalf("expected last seen to be kept, got %v", sm.presences[alice.String()].lastSeen)
+	}
+}
@@ -0,0 +1,63 @@
+package messages
+
+import "sort"
+
+// SetReaction stores the reaction of a sender to a message, replacing any earlier
+// reaction of that sender. An empty emoji removes the reaction.
+// Returns true if the stored reactions changed.
+func (md *MessageDatabase) SetReaction(messageID string, reaction Reaction) bool {
+	md.messageLock.Lock()
+	defer md.messageLock.Unlock()
+
+	senders := md.reactions[messageID]
+	existing, ok := senders[reaction.SenderId]
+	if ok && reaction.Timestamp != 0 && reaction.Timestamp < existing.Timestamp {
+		return false
+	}
+	if reaction.Emoji == "" {
+		if !ok {
+			return false
+		}
+		delete(senders, reaction.SenderId)
+		if len(senders) == 0 {
+			delete(md.reactions, messageID)
+		}
+		md.deleteReaction(messageID, reaction.SenderId)
+		return true
+	}
+	if ok && existing == reaction {
+		return false
+	}
+	if senders == nil {
+		senders = make(map[string]Reaction)
+		md.reactions[messageID] = senders
+	}
+	senders[reaction.SenderId] = reaction
+	md.persistReaction(messageID, reaction)
+	return true
+}
+
+// GetReactions returns the reactions to a message, oldest first.
+func (md *MessageDatabase) GetReactions(messageID string) []Reaction {
+	md.messageLock.RLock()
+	defer md.messageLock.RUnlock()
+	return md.reactionsLocked(messageID)
+}
+
+func (md *MessageDatabase) reactionsLocked(messageID string) []Reaction {
+	senders := md.reactions[messageID]
+	if len(senders) == 0 {
+		return nil
+	}
+	out := make([]Reaction, 0, len(senders))
+	for _, reaction := range senders {
+		out = append(out, reaction)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Timestamp == out[j].Timestamp {
+			return out[i].SenderId < out[j].SenderId
+		}
+		return out[i].Timestamp < out[j].Timestamp
+	})
+	return out
+}
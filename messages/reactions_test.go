@@ -0,0 +1,44 @@
+package messages
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSetReactionKeepsOnePerSender(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "messages.db")
+	db := &MessageDatabase{}
+	if err := db.Open(path); err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	db.AddMessage(Message{Id: "msg-1", ChatId: "group@g.us", Timestamp: 1, Text: "hello"}, false)
+
+	if !db.SetReaction("msg-1", Reaction{SenderId: "a@s.whatsapp.net", Emoji: "👍", Timestamp: 2}) {
+		t.Fatal("expected new reaction to be stored")
+	}
+	db.SetReaction("msg-1", Reaction{SenderId: "b@s.whatsapp.net", Emoji: "👍", Timestamp: 3})
+	db.SetReaction("msg-1", Reaction{SenderId: "a@s.whatsapp.net", Emoji: "❤", Timestamp: 4})
+	if db.SetReaction("msg-1", Reaction{SenderId: "a@s.whatsapp.net", Emoji: "😮", Timestamp: 1}) {
+		t.Fatal("expected older reaction to be ignored")
+	}
+
+	msg, _ := db.GetMessage("msg-1")
+	if len(msg.Reactions) != 2 || msg.Reactions[0].Emoji != "👍" || msg.Reactions[1].Emoji != "❤" {
+		t.Fatalf("unexpected reactions: %#v", msg.Reactions)
+	}
+
+	if !db.SetReaction("msg-1", Reaction{SenderId: "b@s.whatsapp.net", Timestamp: 5}) {
+		t.Fatal("expected empty reaction to remove the reaction")
+	}
+	db.Close()
+
+	db = &MessageDatabase{}
+	if err := db.Open(path); err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer db.Close()
+	msgs := db.GetMessages("group@g.us")
+	if len(msgs) != 1 || len(msgs[0].Reactions) != 1 || msgs[0].Reactions[0].SenderId != "a@s.whatsapp.net" {
+		t.Fatalf("unexpected reactions after reopen: %#v", msgs)
+	}
+}
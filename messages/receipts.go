@@ -0,0 +1,111 @@
+package messages
+
+import (
+	"sort"
+	"strings"
+)
+
+// labels of the receipts in the message info
+var receiptLabels = map[ReceiptState]string{
+	ReceiptSent:      "Sent to",
+	ReceiptDelivered: "Delivered to",
+	ReceiptRead:      "Read by",
+	ReceiptPlayed:    "Played by",
+}
+
+func (state ReceiptState) String() string {
+	switch state {
+	case ReceiptDelivered:
+		return "delivered"
+	case ReceiptRead:
+		return "read"
+	case ReceiptPlayed:
+		return "played"
+	default:
+		return "sent"
+	}
+}
+
+// SetReceipt stores the receipt of a recipient for an own message. A receipt
+// never lowers the state, e.g. a late delivery receipt after the read receipt.
+// Returns true if the stored receipts changed.
+func (md *MessageDatabase) SetReceipt(messageID string, receipt Receipt) bool {
+	md.messageLock.Lock()
+	defer md.messageLock.Unlock()
+
+	if msg, ok := md.messagesById[messageID]; !ok || !msg.FromMe {
+		return false
+	}
+	participants := md.receipts[messageID]
+	if existing, ok := participants[receipt.ParticipantId]; ok && existing.State >= receipt.State {
+		return false
+	}
+	if participants == nil {
+		participants = make(map[string]Receipt)
+		md.receipts[messageID] = participants
+	}
+	participants[receipt.ParticipantId] = receipt
+	md.persistReceipt(messageID, receipt)
+	return true
+}
+
+// GetReceipts returns the receipts of a message, sorted by recipient.
+func (md *MessageDatabase) GetReceipts(messageID string) []Receipt {
+	md.messageLock.RLock()
+	defer md.messageLock.RUnlock()
+	return md.receiptsLocked(messageID)
+}
+
+func (md *MessageDatabase) receiptsLocked(messageID string) []Receipt {
+	participants := md.receipts[messageID]
+	if len(participants) == 0 {
+		return nil
+	}
+	out := make([]Receipt, 0, len(participants))
+	for _, receipt := range participants {
+		out = append(out, receipt)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].ParticipantId < out[j].ParticipantId
+	})
+	return out
+}
+
+// recipientCountLocked returns the number of members an own group message
+// went to, we are a member ourselves. It is 0 if the members are unknown.
+func (md *MessageDatabase) recipientCountLocked(msg Message) int {
+	if !msg.FromMe || !strings.HasSuffix(msg.ChatId, GROUPSUFFIX) {
+		return 0
+	}
+	md.chatLock.RLock()
+	defer md.chatLock.RUnlock()
+	if members := len(md.groupMembers[msg.ChatId]); members > 1 {
+		return members - 1
+	}
+	return 0
+}
+
+// ReceiptState returns the state that all recipients of an own message have
+// reached. In groups with known members every member has to send a receipt,
+// otherwise the receipts that arrived count.
+func (msg Message) ReceiptState() ReceiptState {
+	needed := msg.Recipients
+	if needed == 0 {
+		needed = len(msg.Receipts)
+	}
+	if needed == 0 {
+		return ReceiptSent
+	}
+	for state := ReceiptPlayed; state > ReceiptSent; state-- {
+		count := 0
+		for _, receipt := range msg.Receipts {
+			if receipt.State >= state {
+				count++
+			}
+		}
+		if count >= needed {
+			return state
+		}
+	}
+	return ReceiptSent
+}
@@ -0,0 +1,93 @@
+package messages
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func TestSetReceiptNeverDowngrades(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "messages.db")
+	db := &MessageDatabase{}
+	if err := db.Open(path); err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	db.AddMessage(Message{Id: "own", ChatId: "group@g.us", FromMe: true, Timestamp: 1, Text: "hello"}, false)
+	db.AddMessage(Message{Id: "other", ChatId: "group@g.us", Timestamp: 2, Text: "hi"}, false)
+
+	if db.SetReceipt("other", Receipt{ParticipantId: "a@s.whatsapp.net", State: ReceiptRead}) {
+		t.Fatal("expected receipts for other messages to be ignored")
+	}
+	db.SetReceipt("own", Receipt{ParticipantId: "a@s.whatsapp.net", State: ReceiptRead, Timestamp: 5})
+	db.SetReceipt("own", Receipt{ParticipantId: "b@s.whatsapp.net", State: ReceiptDelivered, Timestamp: 4})
+	if db.SetReceipt("own", Receipt{ParticipantId: "a@s.whatsapp.net", State: ReceiptDelivered, Timestamp: 6}) {
+		t.Fatal("expected late delivery receipt to be ignored")
+	}
+	db.Close()
+
+	db = &MessageDatabase{}
+	if err := db.Open(path); err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer db.Close()
+	msg, _ := db.GetMessage("own")
+	if len(msg.Receipts) != 2 || msg.Receipts[0].State != ReceiptRead || msg.ReceiptState() != ReceiptDelivered {
+		t.Fatalf("unexpected receipts: %#v", msg.Receipts)
+	}
+	db.SetReceipt("own", Receipt{ParticipantId: "b@s.whatsapp.net", State: ReceiptRead, Timestamp: 7})
+	if msg, _ = db.GetMessage("own"); msg.ReceiptState() != ReceiptRead {
+		t.Fatalf("expected message to be read by all, got %v", msg.ReceiptState())
+	}
+	info := db.GetMessageInfo("own")
+	if !strings.Contains(info, "Status: read") || !strings.Contains(info, "Read by: a ("+time.Unix(5, 0).Format(time.RFC1123)+")") {
+		t.Fatalf("unexpected info: %s", info)
+	}
+}
+
+func TestHandleReceiptStoresReader(t *testing.T) {
+	db := &MessageDatabase{}
+	db.Init()
+	eh := &eventHandler{sm: &SessionManager{db: db}}
+	db.AddMessage(Message{Id: "own", ChatId: "123@s.whatsapp.net", FromMe: true, Timestamp: 1, Text: "hello"}, false)
+
+	sender := types.NewJID("123", types.DefaultUserServer)
+	sender.Device = 2
+	eh.handleReceipt(&events.Receipt{
+		MessageSource: types.MessageSource{Chat: types.NewJID("123", types.DefaultUserServer), Sender: sender},
+		MessageIDs:    []types.MessageID{"own"},
+		Timestamp:     time.Unix(10, 0),
+		Type:          types.ReceiptTypePlayed,
+	})
+
+	receipts := db.GetReceipts("own")
+	if len(receipts) != 1 || receipts[0].ParticipantId != "123@s.whatsapp.net" || receipts[0].State != ReceiptPlayed || receipts[0].Timestamp != 10 {
+		t.Fatalf("unexpected receipts: %#v", receipts)
+	}
+}
+
+func TestGroupReceiptStateWaitsForAllMembers(t *testing.T) {
+	db := &MessageDatabase{}
+	db.Init()
+	group := "group@g.us"
+	db.SetGroupMembers(group, []string{"me@s.whatsapp.net", "a@s.whatsapp.net", "b@s.whatsapp.net", "c@s.whatsapp.net"})
+	db.AddMessage(Message{Id: "own", ChatId: group, FromMe: true, Timestamp: 1, Text: "hello"}, false)
+
+	db.SetReceipt("own", Receipt{ParticipantId: "a@s.whatsapp.net", State: ReceiptRead, Timestamp: 2})
+	if msg, _ := db.GetMessage("own"); msg.ReceiptState() != ReceiptSent {
+		t.Fatalf("expected sent while others have no receipt, got %v", msg.ReceiptState())
+	}
+	db.SetReceipt("own", Receipt{ParticipantId: "b@s.whatsapp.net", State: ReceiptDelivered, Timestamp: 3})
+	db.SetReceipt("own", Receipt{ParticipantId: "c@s.whatsapp.net", State: ReceiptRead, Timestamp: 4})
+	if msg, _ := db.GetMessage("own"); msg.ReceiptState() != ReceiptDelivered {
+		t.Fatalf("expected delivered until all members read, got %v", msg.ReceiptState())
+	}
+	db.SetReceipt("own", Receipt{ParticipantId: "b@s.whatsapp.net", State: ReceiptRead, Timestamp: 5})
+	msgs := db.GetMessages(group)
+	if len(msgs) != 1 || msgs[0].ReceiptState() != ReceiptRead {
+		t.Fatalf("expected read by all members, got %#v", msgs)
+	}
+}
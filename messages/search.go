@@ -0,0 +1,130 @@
+package messages
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// SearchMessages returns messages from all chats that contain every word of the query
+// in their text, file name or sender name, newest first.
+func (md *MessageDatabase) SearchMessages(query string, limit int) []Message {
+	terms := searchTokens(query)
+	if len(terms) == 0 {
+		return nil
+	}
+
+	md.messageLock.RLock()
+	var matches map[string]struct{}
+	for _, term := range terms {
+		termMatches := make(map[string]struct{})
+		for token, ids := range md.searchIndex {
+			if !strings.Contains(token, term) {
+				continue
+			}
+			for id := range ids {
+				if matches == nil {
+					termMatches[id] = struct{}{}
+				} else if _, ok := matches[id]; ok {
+					termMatches[id] = struct{}{}
+				}
+			}
+		}
+		matches = termMatches
+		if len(matches) == 0 {
+			break
+		}
+	}
+	results := make([]Message, 0, len(matches))
+	for id := range matches {
+		if msg, ok := md.messagesById[id]; ok {
+			results = append(results, msg)
+		}
+	}
+	md.messageLock.RUnlock()
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Timestamp == results[j].Timestamp {
+			return results[i].Id > results[j].Id
+		}
+		return results[i].Timestamp > results[j].Timestamp
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+func (md *MessageDatabase) indexMessageLocked(msg Message) {
+	for _, token := range messageSearchTokens(msg) {
+		ids, ok := md.searchIndex[token]
+		if !ok {
+			ids = make(map[string]struct{})
+			md.searchIndex[token] = ids
+		}
+		ids[msg.Id] = struct{}{}
+	}
+}
+
+func (md *MessageDatabase) unindexMessageLocked(msg Message) {
+	for _, token := range messageSearchTokens(msg) {
+		if ids, ok := md.searchIndex[token]; ok {
+			delete(ids, msg.Id)
+			if len(ids) == 0 {
+				delete(md.searchIndex, token)
+			}
+		}
+	}
+}
+
+func messageSearchTokens(msg Message) []string {
+	return searchTokens(strings.Join([]string{msg.Text, msg.FileName, msg.ContactName, msg.ContactShort}, " "))
+}
+
+// searchTokens splits text into unique lower case words
+func searchTokens(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	seen := make(map[string]struct{}, len(words))
+	tokens := make([]string, 0, len(words))
+	for _, word := range words {
+		if _, ok := seen[word]; ok {
+			continue
+		}
+		seen[word] = struct{}{}
+		tokens = append(tokens, word)
+	}
+	return tokens
+}
+
+// SearchSnippet returns a single line excerpt of text of at most width runes,
+// centered around the first word of the query found in it.
+func SearchSnippet(text, query string, width int) string {
+	runes := []rune(strings.Join(strings.Fields(text), " "))
+	if len(runes) <= width {
+		return string(runes)
+	}
+	lower := []rune(strings.ToLower(string(runes)))
+	start := 0
+	for _, term := range searchTokens(query) {
+		if idx := strings.Index(string(lower), term); idx >= 0 {
+			start = len([]rune(string(lower)[:idx])) - width/3
+			break
+		}
+	}
+	if start < 0 {
+		start = 0
+	}
+	if start > len(runes)-width {
+		start = len(runes) - width
+	}
+	out := string(runes[start : start+width])
+	if start > 0 {
+		out = "…" + out
+	}
+	if start+width < len(runes) {
+		out += "…"
+	}
+	return out
+}
@@ -0,0 +1,51 @@
+package messages
+
+import "testing"
+
+func TestSearchMessagesMatchesAllTerms(t *testing.T) {
+	db := &MessageDatabase{}
+	db.Init()
+
+	db.AddMessage(Message{Id: "a", ChatId: "1@s.whatsapp.net", ContactName: "Alice", Timestamp: 1, Text: "Meeting tomorrow at noon"}, false)
+	db.AddMessage(Message{Id: "b", ChatId: "2@g.us", ContactName: "Bob", Timestamp: 2, Text: "Is the meeting moved?"}, false)
+	db.AddMessage(Message{Id: "c", ChatId: "2@g.us", ContactName: "Bob", Timestamp: 3, Text: "[DOCUMENT]", FileName: "agenda.pdf"}, false)
+
+	results := db.SearchMessages("MEET", 0)
+	if len(results) != 2 || results[0].Id != "b" || results[1].Id != "a" {
+		t.Fatalf("expected newest matches first, got %#v", results)
+	}
+	if results = db.SearchMessages("meeting alice", 0); len(results) != 1 || results[0].Id != "a" {
+		t.Fatalf("expected sender name to match, got %#v", results)
+	}
+	if results = db.SearchMessages("agenda", 0); len(results) != 1 || results[0].Id != "c" {
+		t.Fatalf("expected file name to match, got %#v", results)
+	}
+
+	db.MarkMessageRevoked("b")
+	if results = db.SearchMessages("moved", 0); len(results) != 0 {
+		t.Fatalf("expected revoked text to be removed from index, got %#v", results)
+	}
+}
+
+func TestSearchSnippetCentersOnMatch(t *testing.T) {
+	text := "one two three four five six seven eight nine ten eleven twelve"
+	got := SearchSnippet(text, "nine", 20)
+	if len([]rune(got)) > 22 {
+		t.Fatalf("snippet too long: %q", got)
+	}
+	if !containsWord(got, "nine") {
+		t.Fatalf("expected snippet to contain match, got %q", got)
+	}
+	if got = SearchSnippet("short", "short", 20); got != "short" {
+		t.Fatalf("expected short text unchanged, got %q", got)
+	}
+}
+
+func containsWord(text, word string) bool {
+	for _, token := range searchTokens(text) {
+		if token == word {
+			return true
+		}
+	}
+	return false
+}
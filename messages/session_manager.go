@@ -7,11 +7,14 @@ import (
 	"mime"
 	"net/http"
 	"os"
+	"os/exec"
 	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/gen2brain/beeep"
@@ -21,6 +24,7 @@ import (
 	"github.com/rivo/tview"
 	"go.mau.fi/whatsmeow"
 	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/proto/waWeb"
 	"go.mau.fi/whatsmeow/store/sqlstore"
 	"go.mau.fi/whatsmeow/types"
 	"go.mau.fi/whatsmeow/types/events"
@@ -30,8 +34,15 @@ import (
 
 var urlPattern = regexp.MustCompile(`https?://[^\s]+`)
 
+const searchResultLimit = 100
+
+// delays between attempts to send queued messages
+const outboxBaseDelay = 5 * time.Second
+const outboxMaxDelay = 5 * time.Minute
+
 // SessionManager deals with the connection and receives commands from the UI.
 type SessionManager struct {
+	Account         string // the name of the account, the current one if empty
 	db              *MessageDatabase
 	currentReceiver string
 	uiHandler       UiMessageHandler
@@ -40,27 +51,48 @@ type SessionManager struct {
 	BatteryChannel  chan BatteryMsg
 	StatusChannel   chan StatusMsg
 	CommandChannel  chan Command
+	RequestChannel  chan CommandRequest
 	ChatChannel     chan Chat
 	ContactChannel  chan Contact
 	TextChannel     chan *waProto.Message
+	PresenceChannel chan interface{}
 	statusInfo      SessionStatus
 	lastSent        time.Time
 	started         bool
 	eventHandler    *eventHandler
+	outboxTimer     *time.Timer
+	chatStates      map[string]map[string]chatState
+	presences       map[string]contactPresence
+	recording       *voiceRecording
+	invite          *groupInvite
+	player          *exec.Cmd
+	offlineSynced   chan struct{}
+	stopManager     chan struct{}
+	managerDone     chan error
 }
 
 // Init initializes the SessionManager.
 func (sm *SessionManager) Init(handler UiMessageHandler) {
+	if sm.Account == "" {
+		sm.Account = config.GetAccount()
+	}
 	sm.db = &MessageDatabase{}
 	sm.db.Init()
 	sm.uiHandler = handler
 	sm.BatteryChannel = make(chan BatteryMsg, 10)
 	sm.StatusChannel = make(chan StatusMsg, 10)
 	sm.CommandChannel = make(chan Command, 10)
+	sm.RequestChannel = make(chan CommandRequest)
 	sm.ChatChannel = make(chan Chat, 10)
 	sm.ContactChannel = make(chan Contact, 10)
 	sm.TextChannel = make(chan *waProto.Message, 10)
+	sm.PresenceChannel = make(chan interface{}, 10)
+	sm.chatStates = make(map[string]map[string]chatState)
+	sm.presences = make(map[string]contactPresence)
 	sm.eventHandler = &eventHandler{sm: sm}
+	sm.offlineSynced = make(chan struct{}, 1)
+	sm.stopManager = make(chan struct{})
+	sm.managerDone = make(chan error, 1)
 }
 
 // StartManager starts the receiver and message handling goroutine.
@@ -69,11 +101,32 @@ func (sm *SessionManager) StartManager() error {
 		return errors.New("session manager running, send commands to control")
 	}
 	sm.started = true
-	go sm.runManager()
+	go func() {
+		sm.managerDone <- sm.runManager()
+	}()
 	return nil
 }
 
+// StopManager ends the manager goroutine and waits until it has disconnected
+// and closed the message store.
+func (sm *SessionManager) StopManager() error {
+	if !sm.started {
+		return nil
+	}
+	close(sm.stopManager)
+	return <-sm.managerDone
+}
+
 func (sm *SessionManager) runManager() error {
+	if err := sm.db.Open(config.GetMessageStoreFilePath(sm.Account)); err != nil {
+		sm.uiHandler.PrintError(err)
+		sm.db.Init()
+	}
+	sm.db.ErrorHandler = sm.uiHandler.PrintError
+	sm.uiHandler.SetChats(sm.db.GetChatIds())
+	sm.outboxTimer = time.NewTimer(outboxMaxDelay)
+	sm.outboxTimer.Stop()
+
 	client, err := sm.getConnection()
 	if err != nil {
 		sm.uiHandler.PrintError(fmt.Errorf("failed to create WhatsApp connection: %v", err))
@@ -91,6 +144,15 @@ func (sm *SessionManager) runManager() error {
 		select {
 		case command := <-sm.CommandChannel:
 			sm.execCommand(command)
+		case request := <-sm.RequestChannel:
+			sm.execCommand(request.Command)
+			close(request.Done)
+		case <-sm.stopManager:
+			sm.started = false
+		case <-sm.outboxTimer.C:
+			sm.flushOutbox()
+		case evt := <-sm.PresenceChannel:
+			sm.handlePresence(evt)
 		case batteryMsg := <-sm.BatteryChannel:
 			sm.statusInfo.BatteryLoading = batteryMsg.loading
 			sm.statusInfo.BatteryPowersave = batteryMsg.powersave
@@ -110,6 +172,8 @@ func (sm *SessionManager) runManager() error {
 			if prevStatus != sm.statusInfo.Connected {
 				if sm.statusInfo.Connected {
 					sm.uiHandler.PrintText("connected")
+					sm.announcePresence()
+					sm.flushOutbox()
 				} else {
 					sm.uiHandler.PrintText("disconnected")
 				}
@@ -118,20 +182,78 @@ func (sm *SessionManager) runManager() error {
 	}
 
 	fmt.Fprintln(sm.uiHandler.GetWriter(), "closing the receiver")
+	sm.stopVoice()
 	if sm.client != nil {
 		sm.client.Disconnect()
 	}
+	return sm.db.Close()
+}
+
+// Connect opens the message store and connects with the stored login, for
+// one-shot use without the manager routine. Call Close when done.
+func (sm *SessionManager) Connect(timeout time.Duration) error {
+	if err := sm.OpenStore(); err != nil {
+		return err
+	}
+	client, err := sm.getConnection()
+	if err != nil {
+		return fmt.Errorf("failed to create WhatsApp connection: %v", err)
+	}
+	if client.Store.ID == nil {
+		return errors.New("not logged in, log in first by starting whatscli without arguments and scanning the QR code")
+	}
+	if err = client.Connect(); err != nil {
+		return fmt.Errorf("connection failed: %v", err)
+	}
+	if !client.WaitForConnection(timeout) {
+		return errors.New("timed out waiting for WhatsApp connection")
+	}
 	return nil
 }
 
+// Sync connects and waits until the messages received while whatscli was not
+// running are stored.
+func (sm *SessionManager) Sync(timeout time.Duration) error {
+	if err := sm.Connect(timeout); err != nil {
+		return err
+	}
+	select {
+	case <-sm.offlineSynced:
+		return nil
+	case <-time.After(timeout):
+		return errors.New("timed out waiting for messages received while offline")
+	}
+}
+
+// OpenStore opens the local message store without connecting.
+func (sm *SessionManager) OpenStore() error {
+	return sm.db.Open(config.GetMessageStoreFilePath(sm.Account))
+}
+
+// Close disconnects and closes the message store.
+func (sm *SessionManager) Close() error {
+	if sm.client != nil {
+		sm.client.Disconnect()
+	}
+	return sm.db.Close()
+}
+
+// FindChat resolves a chat id, phone number or chat name to a chat id.
+func (sm *SessionManager) FindChat(query string) (string, error) {
+	return sm.db.FindChat(query)
+}
+
 func (sm *SessionManager) setCurrentReceiver(id string) {
 	sm.currentReceiver = id
-	sm.uiHandler.NewScreen(sm.getMessages(id))
+	sm.uiHandler.NewScreen(sm.GetMessages(id))
+	sm.loadGroupMembers(id)
+	sm.subscribePresence(id)
+	sm.updateChatPresence()
 }
 
 func (sm *SessionManager) getConnection() (*whatsmeow.Client, error) {
 	if sm.client == nil {
-		dbPath := config.GetSessionFilePath() + ".db"
+		dbPath := config.GetAccountSessionFilePath(sm.Account) + ".db"
 		container, err := sqlstore.New(context.Background(), "sqlite3", "file:"+dbPath+"?_foreign_keys=on", waLog.Noop)
 		if err != nil {
 			return nil, fmt.Errorf("failed to connect to database: %v", err)
@@ -205,6 +327,10 @@ func (sm *SessionManager) loginWithQRCode(client *whatsmeow.Client) error {
 		switch evt.Event {
 		case "code":
 			terminal := qrcode.New()
+			if printer, ok := sm.uiHandler.(QRCodePrinter); ok {
+				printer.PrintQRCode(string(*terminal.Get(evt.Code)))
+				continue
+			}
 			terminal.SetOutput(tview.ANSIWriter(sm.uiHandler.GetWriter()))
 			terminal.Get(evt.Code).Print()
 		case "success":
@@ -324,6 +450,7 @@ func (sm *SessionManager) getChatName(jid types.JID) string {
 }
 
 func (sm *SessionManager) disconnect() error {
+	sm.stopVoice()
 	if sm.client != nil && sm.client.IsConnected() {
 		sm.client.Disconnect()
 		sm.StatusChannel <- StatusMsg{false, nil}
@@ -345,92 +472,147 @@ func (sm *SessionManager) logout() error {
 	}
 	sm.client = nil
 	sm.container = nil
+	sm.clearMessageStore()
 	sm.StatusChannel <- StatusMsg{false, nil}
 	sm.uiHandler.PrintText("Successfully logged out")
 	return nil
 }
 
+// sessionCommands are the commands the session manager handles, by name.
+// The daemon offers the same commands as JSON-RPC methods.
+var sessionCommands = map[string]func(sm *SessionManager, params []string){
+	"backlog":      func(sm *SessionManager, params []string) { sm.loadBacklog() },
+	"more":         func(sm *SessionManager, params []string) { sm.loadBacklog() },
+	"login":        func(sm *SessionManager, params []string) { sm.connectCommand() },
+	"connect":      func(sm *SessionManager, params []string) { sm.connectCommand() },
+	"reset":        func(sm *SessionManager, params []string) { sm.resetSession() },
+	"disconnect":   func(sm *SessionManager, params []string) { sm.uiHandler.PrintError(sm.disconnect()) },
+	"logout":       func(sm *SessionManager, params []string) { sm.uiHandler.PrintError(sm.logout()) },
+	"send":         (*SessionManager).sendCommand,
+	"select":       (*SessionManager).selectCommand,
+	"read":         func(sm *SessionManager, params []string) { sm.markCurrentChatRead() },
+	"search":       (*SessionManager).searchMessages,
+	"export":       (*SessionManager).exportCommand,
+	"import":       (*SessionManager).importCommand,
+	"outbox":       (*SessionManager).outboxCommand,
+	"typing":       (*SessionManager).sendTyping,
+	"whois":        (*SessionManager).whoisCommand,
+	"info":         (*SessionManager).infoCommand,
+	"download":     func(sm *SessionManager, params []string) { sm.downloadCommand(params, false, false) },
+	"open":         func(sm *SessionManager, params []string) { sm.downloadCommand(params, true, false) },
+	"show":         func(sm *SessionManager, params []string) { sm.downloadCommand(params, true, true) },
+	"url":          (*SessionManager).openMessageURL,
+	"upload":       func(sm *SessionManager, params []string) { sm.sendMediaCommand(params, MessageKindDocument) },
+	"sendimage":    func(sm *SessionManager, params []string) { sm.sendMediaCommand(params, MessageKindImage) },
+	"sendvideo":    func(sm *SessionManager, params []string) { sm.sendMediaCommand(params, MessageKindVideo) },
+	"sendaudio":    func(sm *SessionManager, params []string) { sm.sendMediaCommand(params, MessageKindAudio) },
+	"sendcontact":  (*SessionManager).sendContactCommand,
+	"sendlocation": (*SessionManager).sendLocationCommand,
+	"sendsticker":  (*SessionManager).sendStickerCommand,
+	"voice":        (*SessionManager).voiceCommand,
+	"poll":         (*SessionManager).pollCommand,
+	"vote":         (*SessionManager).voteCommand,
+	"play":         (*SessionManager).playCommand,
+	"reply":        (*SessionManager).replyToMessage,
+	"react":        (*SessionManager).reactToMessage,
+	"revoke":       (*SessionManager).revokeMessage,
+	"edit":         (*SessionManager).editMessage,
+	"leave":        func(sm *SessionManager, params []string) { sm.leaveCurrentGroup() },
+	"create":       (*SessionManager).createGroup,
+	"add": func(sm *SessionManager, params []string) {
+		sm.updateCurrentGroupParticipants(params, whatsmeow.ParticipantChangeAdd, "add", "added new members")
+	},
+	"remove": func(sm *SessionManager, params []string) {
+		sm.updateCurrentGroupParticipants(params, whatsmeow.ParticipantChangeRemove, "remove", "removed members")
+	},
+	"admin": func(sm *SessionManager, params []string) {
+		sm.updateCurrentGroupParticipants(params, whatsmeow.ParticipantChangePromote, "admin", "promoted members")
+	},
+	"removeadmin": func(sm *SessionManager, params []string) {
+		sm.updateCurrentGroupParticipants(params, whatsmeow.ParticipantChangeDemote, "removeadmin", "demoted members")
+	},
+	"subject":     (*SessionManager).updateCurrentGroupSubject,
+	"description": (*SessionManager).updateCurrentGroupDescription,
+	"announce": func(sm *SessionManager, params []string) {
+		sm.updateCurrentGroupSwitch(params, "announce", "only admins send messages", "all members send messages", (*whatsmeow.Client).SetGroupAnnounce)
+	},
+	"locked": func(sm *SessionManager, params []string) {
+		sm.updateCurrentGroupSwitch(params, "locked", "only admins edit group info", "all members edit group info", (*whatsmeow.Client).SetGroupLocked)
+	},
+	"approval": func(sm *SessionManager, params []string) {
+		sm.updateCurrentGroupSwitch(params, "approval", "admins approve new members", "new members join without approval", (*whatsmeow.Client).SetGroupJoinApprovalMode)
+	},
+	"disappearing": (*SessionManager).updateCurrentGroupDisappearing,
+	"invitelink":   (*SessionManager).showInviteLink,
+	"join":         (*SessionManager).joinGroup,
+	"colorlist":    func(sm *SessionManager, params []string) { sm.printColorList() },
+}
+
+// IsCommand returns true if the session manager handles the command with the given name.
+func IsCommand(name string) bool {
+	_, ok := sessionCommands[name]
+	return ok
+}
+
+// Commands returns the names of all commands the session manager handles, sorted.
+func Commands() []string {
+	names := make([]string, 0, len(sessionCommands))
+	for name := range sessionCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func (sm *SessionManager) execCommand(command Command) {
-	switch command.Name {
-	default:
+	run, ok := sessionCommands[command.Name]
+	if !ok {
 		sm.uiHandler.PrintText("[" + config.Config.Colors.Negative + "]Unknown command: [-]" + command.Name)
-	case "backlog":
-		sm.loadBacklog()
-	case "login", "connect":
-		err := sm.login()
-		if err != nil {
-			sm.uiHandler.PrintError(fmt.Errorf("WhatsApp connection failed: %v", err))
-			sm.uiHandler.PrintText("Try using /reset to completely reset the connection")
-		} else {
-			sm.uiHandler.PrintText("Successfully connected to WhatsApp")
-		}
-	case "reset":
-		sm.resetSession()
-	case "disconnect":
-		sm.uiHandler.PrintError(sm.disconnect())
-	case "logout":
-		sm.uiHandler.PrintError(sm.logout())
-	case "send":
-		if checkParam(command.Params, 2) {
-			sm.sendText(command.Params[0], strings.Join(command.Params[1:], " "))
-		} else {
-			sm.printCommandUsage("send", "[chat-id[] [message text[]")
-		}
-	case "select":
-		if checkParam(command.Params, 1) {
-			sm.setCurrentReceiver(command.Params[0])
-		} else {
-			sm.printCommandUsage("select", "[chat-id[]")
-		}
-	case "read":
-		sm.markCurrentChatRead()
-	case "info":
-		if checkParam(command.Params, 1) {
-			sm.uiHandler.PrintText(sm.db.GetMessageInfo(command.Params[0]))
-		} else {
-			sm.printCommandUsage("info", "[message-id[]")
-		}
-	case "download":
-		sm.downloadCommand(command.Params, false, false)
-	case "open":
-		sm.downloadCommand(command.Params, true, false)
-	case "show":
-		sm.downloadCommand(command.Params, true, true)
-	case "url":
-		sm.openMessageURL(command.Params)
-	case "upload":
-		sm.sendMediaCommand(command.Params, MessageKindDocument)
-	case "sendimage":
-		sm.sendMediaCommand(command.Params, MessageKindImage)
-	case "sendvideo":
-		sm.sendMediaCommand(command.Params, MessageKindVideo)
-	case "sendaudio":
-		sm.sendMediaCommand(command.Params, MessageKindAudio)
-	case "revoke":
-		sm.revokeMessage(command.Params)
-	case "leave":
-		sm.leaveCurrentGroup()
-	case "create":
-		sm.createGroup(command.Params)
-	case "add":
-		sm.updateCurrentGroupParticipants(command.Params, whatsmeow.ParticipantChangeAdd, "add", "added new members")
-	case "remove":
-		sm.updateCurrentGroupParticipants(command.Params, whatsmeow.ParticipantChangeRemove, "remove", "removed members")
-	case "admin":
-		sm.updateCurrentGroupParticipants(command.Params, whatsmeow.ParticipantChangePromote, "admin", "promoted members")
-	case "removeadmin":
-		sm.updateCurrentGroupParticipants(command.Params, whatsmeow.ParticipantChangeDemote, "removeadmin", "demoted members")
-	case "subject":
-		sm.updateCurrentGroupSubject(command.Params)
-	case "colorlist":
-		out := ""
-		for idx := range tcell.ColorNames {
-			out += "[" + idx + "]" + idx + "[-]\n"
-		}
-		sm.uiHandler.PrintText(out)
-	case "more":
-		sm.loadBacklog()
+		return
+	}
+	run(sm, command.Params)
+}
+
+func (sm *SessionManager) connectCommand() {
+	err := sm.login()
+	if err != nil {
+		sm.uiHandler.PrintError(fmt.Errorf("WhatsApp connection failed: %v", err))
+		sm.uiHandler.PrintText("Try using /reset to completely reset the connection")
+	} else {
+		sm.uiHandler.PrintText("Successfully connected to WhatsApp")
+	}
+}
+
+func (sm *SessionManager) sendCommand(params []string) {
+	if checkParam(params, 2) {
+		sm.uiHandler.PrintError(sm.SendText(params[0], strings.Join(params[1:], " ")))
+	} else {
+		sm.printCommandUsage("send", "[chat-id[] [message text[]")
+	}
+}
+
+func (sm *SessionManager) selectCommand(params []string) {
+	if checkParam(params, 1) {
+		sm.setCurrentReceiver(params[0])
+	} else {
+		sm.printCommandUsage("select", "[chat-id[]")
+	}
+}
+
+func (sm *SessionManager) infoCommand(params []string) {
+	if checkParam(params, 1) {
+		sm.uiHandler.PrintText(sm.db.GetMessageInfo(params[0]))
+	} else {
+		sm.printCommandUsage("info", "[message-id[]")
+	}
+}
+
+func (sm *SessionManager) printColorList() {
+	out := ""
+	for idx := range tcell.ColorNames {
+		out += "[" + idx + "]" + idx + "[-]\n"
 	}
+	sm.uiHandler.PrintText(out)
 }
 
 func (sm *SessionManager) loadBacklog() {
@@ -513,14 +695,26 @@ func (sm *SessionManager) resetSession() {
 
 	sm.client = nil
 	sm.container = nil
-	dbPath := config.GetSessionFilePath() + ".db"
+	dbPath := config.GetAccountSessionFilePath(sm.Account) + ".db"
 	if err := os.Remove(dbPath); err != nil && !os.IsNotExist(err) {
 		sm.uiHandler.PrintText("Warning: Couldn't remove database file: " + err.Error())
 	}
+	sm.clearMessageStore()
 	sm.StatusChannel <- StatusMsg{false, nil}
 	sm.uiHandler.PrintText("Session reset. Use /connect to reconnect with a new QR code.")
 }
 
+// clearMessageStore drops all stored history, it belongs to the old login
+func (sm *SessionManager) clearMessageStore() {
+	if err := sm.db.Clear(); err != nil {
+		sm.uiHandler.PrintText("Warning: Couldn't clear message store: " + err.Error())
+	}
+	sm.uiHandler.SetChats(sm.db.GetChatIds())
+	if sm.currentReceiver != "" {
+		sm.uiHandler.NewScreen(sm.GetMessages(sm.currentReceiver))
+	}
+}
+
 func (sm *SessionManager) markCurrentChatRead() {
 	if sm.currentReceiver == "" {
 		sm.printCommandUsage("read", "-> only works in a chat")
@@ -581,6 +775,175 @@ func (sm *SessionManager) markCurrentChatRead() {
 	sm.uiHandler.SetChats(sm.db.GetChatIds())
 }
 
+func (sm *SessionManager) searchMessages(params []string) {
+	if !checkParam(params, 1) {
+		sm.printCommandUsage("search", "search text")
+		return
+	}
+	query := strings.Join(params, " ")
+	results := sm.db.SearchMessages(query, searchResultLimit)
+	if len(results) == 0 {
+		sm.uiHandler.PrintText("No messages found for: " + query)
+		return
+	}
+	sm.uiHandler.SearchResults(query, results)
+}
+
+func (sm *SessionManager) exportCommand(params []string) {
+	if sm.currentReceiver == "" {
+		sm.printCommandUsage("export", "-> only works in a chat")
+		return
+	}
+	withMedia := false
+	args := make([]string, 0, len(params))
+	for _, param := range params {
+		if param == "--media" {
+			withMedia = true
+		} else {
+			args = append(args, param)
+		}
+	}
+	if !checkParam(args, 1) {
+		sm.printCommandUsage("export", "["+strings.Join(ExportFormats(), "|")+"[] [/path/to/file[] [--media[]")
+		return
+	}
+	sm.uiHandler.PrintText("exporting chat..")
+	path, err := sm.ExportChat(sm.currentReceiver, args[0], strings.Join(args[1:], " "), withMedia)
+	if err != nil {
+		sm.uiHandler.PrintError(err)
+		return
+	}
+	sm.uiHandler.PrintText("[::d] -> " + path + "[::-]")
+}
+
+// ExportChat writes the stored messages of a chat to a file in the given format
+// and returns its path. Without path, the file is created in the download folder.
+// With media, attachments are downloaded into a folder next to the file.
+func (sm *SessionManager) ExportChat(chatID, format, path string, withMedia bool) (string, error) {
+	ext, ok := exportExtensions[format]
+	if !ok {
+		return "", fmt.Errorf("unknown export format %q, use one of: %s", format, strings.Join(ExportFormats(), ", "))
+	}
+	chatName := sm.db.GetIdName(chatID)
+	if path == "" {
+		path = filepath.Join(config.Config.General.DownloadPath, exportFileName(chatName)+ext)
+	}
+	export := ChatExport{
+		ChatName: chatName,
+		SelfName: "Me",
+		Messages: sm.db.GetMessages(chatID),
+		Media:    make(map[string]string),
+	}
+	if sm.client != nil && sm.client.Store != nil && sm.client.Store.PushName != "" {
+		export.SelfName = sm.client.Store.PushName
+	}
+
+	if withMedia {
+		mediaDir := strings.TrimSuffix(path, filepath.Ext(path)) + "_media"
+		failed := 0
+		for _, msg := range export.Messages {
+			if _, err := downloadableFromMessage(msg); err != nil && msg.LocalPath == "" {
+				continue
+			}
+			file, err := sm.downloadMessageTo(msg, mediaDir)
+			if err != nil {
+				failed++
+				continue
+			}
+			if rel, err := filepath.Rel(filepath.Dir(path), file); err == nil {
+				export.Media[msg.Id] = filepath.ToSlash(rel)
+			}
+		}
+		if failed > 0 {
+			sm.uiHandler.PrintError(fmt.Errorf("failed to download %d attachments", failed))
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if err = export.Write(file, format); err != nil {
+		file.Close()
+		return "", err
+	}
+	return path, file.Close()
+}
+
+// exportFileName creates a file name without extension for an export of a chat
+func exportFileName(chatName string) string {
+	return "whatsapp-" + safeFileName(chatName) + "-" + time.Now().Format("20060102")
+}
+
+// safeFileName replaces all characters except letters, numbers and dashes
+func safeFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) || r == '-' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+func (sm *SessionManager) importCommand(params []string) {
+	if !checkParam(params, 1) {
+		sm.printCommandUsage("import", "/path/to/export.zip -> imports into the current chat or the chat named in the file name")
+		return
+	}
+	file := strings.Join(params, " ")
+	chatID := sm.currentReceiver
+	if chatID == "" {
+		name := ExportChatName(file)
+		if name == "" {
+			sm.uiHandler.PrintError(errors.New("no chat selected and no chat name in the file name"))
+			return
+		}
+		var err error
+		if chatID, err = sm.FindChat(name); err != nil {
+			sm.uiHandler.PrintError(err)
+			return
+		}
+	}
+	sm.uiHandler.PrintText("importing chat..")
+	count, err := sm.ImportChat(chatID, file)
+	if err != nil {
+		sm.uiHandler.PrintError(err)
+		return
+	}
+	sm.uiHandler.PrintText(fmt.Sprintf("[::d] -> imported %d messages into %s[::-]", count, sm.db.GetIdName(chatID)))
+	if sm.currentReceiver == chatID {
+		sm.uiHandler.NewScreen(sm.GetMessages(chatID))
+	}
+	sm.uiHandler.SetChats(sm.db.GetChatIds())
+}
+
+// ImportChat adds the messages of a chat exported with the phone app (.txt or .zip)
+// to a chat as read-only messages and returns how many new messages were added.
+// Attachments of zip files are extracted into the download folder.
+func (sm *SessionManager) ImportChat(chatID, file string) (int, error) {
+	chatName := sm.db.GetIdName(chatID)
+	mediaDir := filepath.Join(config.Config.General.DownloadPath, "whatsapp-import-"+safeFileName(chatName))
+	imported, media, err := ReadChatExport(file, mediaDir)
+	if err != nil {
+		return 0, err
+	}
+	pushName := ""
+	if sm.client != nil && sm.client.Store != nil {
+		pushName = sm.client.Store.PushName
+	}
+	selfName := guessSelfName(imported, chatName, pushName, strings.HasSuffix(chatID, GROUPSUFFIX))
+	count := 0
+	for _, msg := range ImportedMessages(chatID, selfName, imported, media) {
+		if sm.db.AddMessage(msg, false) {
+			count++
+		}
+	}
+	return count, nil
+}
+
 func (sm *SessionManager) downloadCommand(params []string, preview, show bool) {
 	if !checkParam(params, 1) {
 		name := "download"
@@ -598,8 +961,8 @@ func (sm *SessionManager) downloadCommand(params []string, preview, show bool) {
 		sm.uiHandler.PrintError(errors.New("message not found"))
 		return
 	}
-	if show && msg.Kind != MessageKindImage {
-		sm.uiHandler.PrintError(errors.New("show only works for image messages"))
+	if show && msg.Kind != MessageKindImage && msg.Kind != MessageKindSticker {
+		sm.uiHandler.PrintError(errors.New("show only works for image and sticker messages"))
 		return
 	}
 
@@ -608,6 +971,13 @@ func (sm *SessionManager) downloadCommand(params []string, preview, show bool) {
 		sm.uiHandler.PrintError(err)
 		return
 	}
+	if show && msg.Kind == MessageKindSticker {
+		// show commands don't know WebP
+		if path, err = stickerPreview(path); err != nil {
+			sm.uiHandler.PrintError(err)
+			return
+		}
+	}
 	if show {
 		sm.uiHandler.PrintFile(path)
 		return
@@ -630,6 +1000,9 @@ func (sm *SessionManager) openMessageURL(params []string) {
 		return
 	}
 	url := urlPattern.FindString(msg.Text)
+	if msg.Kind == MessageKindLocation {
+		url = locationURL(msg.RawMessage)
+	}
 	if url == "" {
 		sm.uiHandler.PrintText("No URL found in message")
 		return
@@ -650,6 +1023,64 @@ func (sm *SessionManager) sendMediaCommand(params []string, kind MessageKind) {
 	sm.uiHandler.PrintError(sm.sendMedia(sm.currentReceiver, path, kind))
 }
 
+func (sm *SessionManager) replyToMessage(params []string) {
+	if !checkParam(params, 2) {
+		sm.printCommandUsage("reply", "[message-id[] [message text[]")
+		return
+	}
+	quoted, err := sm.getRemoteMessage(params[0])
+	if err != nil {
+		sm.uiHandler.PrintError(err)
+		return
+	}
+	text := strings.Join(params[1:], " ")
+	var mentioned []string
+	if strings.HasSuffix(quoted.ChatId, GROUPSUFFIX) {
+		sm.loadGroupMembers(quoted.ChatId)
+		text, mentioned = sm.db.ResolveMentions(quoted.ChatId, text)
+	}
+	raw := replyMessage(quoted, text)
+	raw.ExtendedTextMessage.ContextInfo.MentionedJID = mentioned
+	sm.uiHandler.PrintError(sm.sendTextMessage(quoted.ChatId, raw, text))
+}
+
+func (sm *SessionManager) reactToMessage(params []string) {
+	if !checkParam(params, 1) {
+		sm.printCommandUsage("react", "[message-id[] [emoji[] -> without emoji removes the reaction")
+		return
+	}
+	if sm.client == nil || !sm.client.IsConnected() {
+		sm.uiHandler.PrintError(errors.New("not connected to WhatsApp"))
+		return
+	}
+
+	msg, err := sm.getRemoteMessage(params[0])
+	if err != nil {
+		sm.uiHandler.PrintError(err)
+		return
+	}
+	chatJID, err := types.ParseJID(msg.ChatId)
+	if err != nil {
+		sm.uiHandler.PrintError(fmt.Errorf("invalid chat JID: %v", err))
+		return
+	}
+	emoji := strings.Join(params[1:], "")
+	raw := sm.client.BuildReaction(chatJID, messageSender(msg), types.MessageID(msg.Id), emoji)
+	resp, err := sm.client.SendMessage(context.Background(), chatJID, raw)
+	if err != nil {
+		sm.uiHandler.PrintError(fmt.Errorf("failed to send reaction: %v", err))
+		return
+	}
+	reaction := Reaction{
+		SenderId:  sm.selfID(),
+		Emoji:     emoji,
+		Timestamp: uint64(resp.Timestamp.Unix()),
+	}
+	if sm.db.SetReaction(msg.Id, reaction) && sm.currentReceiver == msg.ChatId {
+		sm.uiHandler.NewScreen(sm.GetMessages(msg.ChatId))
+	}
+}
+
 func (sm *SessionManager) revokeMessage(params []string) {
 	if !checkParam(params, 1) {
 		sm.printCommandUsage("revoke", "[message-id[]")
@@ -660,9 +1091,9 @@ func (sm *SessionManager) revokeMessage(params []string) {
 		return
 	}
 
-	msg, ok := sm.db.GetMessage(params[0])
-	if !ok {
-		sm.uiHandler.PrintError(errors.New("message not found"))
+	msg, err := sm.getRemoteMessage(params[0])
+	if err != nil {
+		sm.uiHandler.PrintError(err)
 		return
 	}
 	chatJID, err := types.ParseJID(msg.ChatId)
@@ -676,64 +1107,189 @@ func (sm *SessionManager) revokeMessage(params []string) {
 	}
 	sm.db.MarkMessageRevoked(msg.Id)
 	if sm.currentReceiver == msg.ChatId {
-		sm.uiHandler.NewScreen(sm.getMessages(msg.ChatId))
+		sm.uiHandler.NewScreen(sm.GetMessages(msg.ChatId))
 	}
 	sm.uiHandler.PrintText("revoked: " + msg.Id)
 }
 
-func (sm *SessionManager) leaveCurrentGroup() {
-	groupJID, err := sm.currentGroupJID()
-	if err != nil {
-		sm.uiHandler.PrintError(err)
+func (sm *SessionManager) editMessage(params []string) {
+	if !checkParam(params, 2) {
+		sm.printCommandUsage("edit", "[message-id[] [new text[]")
 		return
 	}
-	if err = sm.client.LeaveGroup(context.Background(), groupJID); err != nil {
-		sm.uiHandler.PrintError(err)
+	if sm.client == nil || !sm.client.IsConnected() {
+		sm.uiHandler.PrintError(errors.New("not connected to WhatsApp"))
 		return
 	}
-	sm.uiHandler.PrintText("left group " + groupJID.String())
-}
 
-func (sm *SessionManager) createGroup(params []string) {
-	if !checkParam(params, 1) {
-		sm.printCommandUsage("create", "[user-id[] [user-id[] New Group Subject")
-		sm.printCommandUsage("create", "New Group Subject")
+	msg, err := sm.getRemoteMessage(params[0])
+	if err != nil {
+		sm.uiHandler.PrintError(err)
 		return
 	}
-
-	participants := make([]types.JID, 0)
-	idx := 0
-	for idx < len(params) && strings.Contains(params[idx], CONTACTSUFFIX) {
-		participant, err := types.ParseJID(params[idx])
-		if err != nil {
-			sm.uiHandler.PrintError(fmt.Errorf("invalid user id %q: %v", params[idx], err))
-			return
-		}
-		participants = append(participants, participant)
-		idx++
+	if !msg.FromMe || msg.Kind != MessageKindText {
+		sm.uiHandler.PrintError(errors.New("only own text messages can be edited"))
+		return
 	}
-
-	name := strings.Join(params[idx:], " ")
-	if name == "" {
-		name = strings.Join(params, " ")
-		participants = nil
+	chatJID, err := types.ParseJID(msg.ChatId)
+	if err != nil {
+		sm.uiHandler.PrintError(fmt.Errorf("invalid chat JID: %v", err))
+		return
 	}
-
-	groupInfo, err := sm.client.CreateGroup(context.Background(), whatsmeow.ReqCreateGroup{
-		Name:         name,
-		Participants: participants,
-	})
+	text := strings.Join(params[1:], " ")
+	raw := sm.client.BuildEdit(chatJID, types.MessageID(msg.Id), &waProto.Message{Conversation: proto.String(text)})
+	resp, err := sm.client.SendMessage(context.Background(), chatJID, raw)
 	if err != nil {
-		sm.uiHandler.PrintError(err)
+		sm.uiHandler.PrintError(fmt.Errorf("failed to edit message: %v", err))
 		return
 	}
+	if sm.db.EditMessage(msg.Id, text, uint64(resp.Timestamp.Unix())) && sm.currentReceiver == msg.ChatId {
+		sm.uiHandler.NewScreen(sm.GetMessages(msg.ChatId))
+	}
+}
 
-	sm.db.AddChat(Chat{
-		Id:          groupInfo.JID.String(),
-		IsGroup:     true,
-		Name:        groupInfo.Name,
-		LastMessage: time.Now().Unix(),
-	})
+func (sm *SessionManager) outboxCommand(params []string) {
+	action := "list"
+	if len(params) > 0 {
+		action = params[0]
+	}
+	switch action {
+	case "list":
+		entries := sm.db.GetOutbox()
+		if len(entries) == 0 {
+			sm.uiHandler.PrintText("outbox is empty")
+			return
+		}
+		for _, entry := range entries {
+			state := "waiting for connection"
+			if entry.Failed {
+				state = "failed: " + entry.LastError
+			} else if entry.Attempts > 0 {
+				state = fmt.Sprintf("attempt %d of %d at %s, %s", entry.Attempts+1, config.Config.General.OutboxMaxRetries+1,
+					time.Unix(entry.NextAttempt, 0).Format("15:04:05"), entry.LastError)
+			}
+			sm.uiHandler.PrintText(fmt.Sprintf("[::b]%s[::-] %s: %s [::d](%s)[::-]", entry.Id,
+				tview.Escape(sm.db.GetIdName(entry.ChatId)), tview.Escape(SearchSnippet(entry.Text, "", 40)), tview.Escape(state)))
+		}
+	case "retry":
+		ids := params[1:]
+		if len(ids) == 0 {
+			for _, entry := range sm.db.GetOutbox() {
+				ids = append(ids, entry.Id)
+			}
+		}
+		for _, id := range ids {
+			entry, ok := sm.db.GetOutboxEntry(id)
+			if !ok {
+				sm.uiHandler.PrintError(fmt.Errorf("%s is not in the outbox", id))
+				continue
+			}
+			entry.Attempts = 0
+			entry.NextAttempt = 0
+			entry.Failed = false
+			sm.db.UpdateOutboxEntry(entry)
+			if sm.currentReceiver == entry.ChatId {
+				sm.uiHandler.NewScreen(sm.GetMessages(entry.ChatId))
+			}
+		}
+		if sm.client == nil || !sm.client.IsConnected() {
+			sm.uiHandler.PrintText("not connected, messages will be sent when connected")
+			return
+		}
+		sm.flushOutbox()
+	case "cancel":
+		if !checkParam(params, 2) {
+			sm.printCommandUsage("outbox cancel", "[message-id[]")
+			return
+		}
+		for _, id := range params[1:] {
+			entry, ok := sm.db.GetOutboxEntry(id)
+			if !ok {
+				sm.uiHandler.PrintError(fmt.Errorf("%s is not in the outbox", id))
+				continue
+			}
+			sm.db.RemoveOutboxEntry(id)
+			sm.db.DeleteMessage(id)
+			removeVoiceFile(entry)
+			if sm.currentReceiver == entry.ChatId {
+				sm.uiHandler.NewScreen(sm.GetMessages(entry.ChatId))
+			}
+			sm.uiHandler.PrintText("cancelled: " + id)
+		}
+	default:
+		sm.printCommandUsage("outbox", "[list|retry|cancel[] [message-id[]")
+	}
+}
+
+// getRemoteMessage returns a stored message that exists on WhatsApp,
+// imported messages can not be replied to or changed
+func (sm *SessionManager) getRemoteMessage(id string) (Message, error) {
+	msg, ok := sm.db.GetMessage(id)
+	if !ok {
+		return msg, errors.New("message not found")
+	}
+	if msg.Imported {
+		return msg, errors.New("imported messages are read-only")
+	}
+	if msg.Pending {
+		return msg, errors.New("message has not been sent yet")
+	}
+	return msg, nil
+}
+
+func (sm *SessionManager) leaveCurrentGroup() {
+	groupJID, err := sm.currentGroupJID()
+	if err != nil {
+		sm.uiHandler.PrintError(err)
+		return
+	}
+	if err = sm.client.LeaveGroup(context.Background(), groupJID); err != nil {
+		sm.uiHandler.PrintError(err)
+		return
+	}
+	sm.uiHandler.PrintText("left group " + groupJID.String())
+}
+
+func (sm *SessionManager) createGroup(params []string) {
+	if !checkParam(params, 1) {
+		sm.printCommandUsage("create", "[user-id[] [user-id[] New Group Subject")
+		sm.printCommandUsage("create", "New Group Subject")
+		return
+	}
+
+	participants := make([]types.JID, 0)
+	idx := 0
+	for idx < len(params) && strings.Contains(params[idx], CONTACTSUFFIX) {
+		participant, err := types.ParseJID(params[idx])
+		if err != nil {
+			sm.uiHandler.PrintError(fmt.Errorf("invalid user id %q: %v", params[idx], err))
+			return
+		}
+		participants = append(participants, participant)
+		idx++
+	}
+
+	name := strings.Join(params[idx:], " ")
+	if name == "" {
+		name = strings.Join(params, " ")
+		participants = nil
+	}
+
+	groupInfo, err := sm.client.CreateGroup(context.Background(), whatsmeow.ReqCreateGroup{
+		Name:         name,
+		Participants: participants,
+	})
+	if err != nil {
+		sm.uiHandler.PrintError(err)
+		return
+	}
+
+	sm.db.AddChat(Chat{
+		Id:          groupInfo.JID.String(),
+		IsGroup:     true,
+		Name:        groupInfo.Name,
+		LastMessage: time.Now().Unix(),
+	})
 	sm.uiHandler.SetChats(sm.db.GetChatIds())
 	sm.uiHandler.PrintText("created new group " + groupInfo.JID.String())
 }
@@ -792,6 +1348,204 @@ func (sm *SessionManager) updateCurrentGroupSubject(params []string) {
 	sm.uiHandler.PrintText("updated subject for " + groupJID.String())
 }
 
+func (sm *SessionManager) updateCurrentGroupDescription(params []string) {
+	groupJID, err := sm.currentGroupJID()
+	if err != nil {
+		sm.uiHandler.PrintError(err)
+		return
+	}
+
+	if sm.client == nil || !sm.client.IsConnected() {
+		sm.uiHandler.PrintError(errors.New("not connected to WhatsApp"))
+		return
+	}
+	description := strings.Join(params, " ")
+	if err = sm.client.SetGroupTopic(context.Background(), groupJID, "", "", description); err != nil {
+		sm.uiHandler.PrintError(err)
+		return
+	}
+	if description == "" {
+		sm.uiHandler.PrintText("cleared description of " + groupJID.String())
+	} else {
+		sm.uiHandler.PrintText("updated description of " + groupJID.String())
+	}
+}
+
+// updateCurrentGroupSwitch turns a group setting on or off, the setting is
+// described by the texts printed for both states and applied with the given
+// client method
+func (sm *SessionManager) updateCurrentGroupSwitch(params []string, command, onText, offText string, apply func(*whatsmeow.Client, context.Context, types.JID, bool) error) {
+	groupJID, err := sm.currentGroupJID()
+	if err != nil {
+		sm.uiHandler.PrintError(err)
+		return
+	}
+	on, ok := parseSwitch(params)
+	if !ok {
+		sm.printCommandUsage(command, "on|off -> in group chat, on: "+onText+", off: "+offText)
+		return
+	}
+	if sm.client == nil || !sm.client.IsConnected() {
+		sm.uiHandler.PrintError(errors.New("not connected to WhatsApp"))
+		return
+	}
+	if err = apply(sm.client, context.Background(), groupJID, on); err != nil {
+		sm.uiHandler.PrintError(err)
+		return
+	}
+	if on {
+		sm.uiHandler.PrintText(groupJID.String() + ": " + onText)
+	} else {
+		sm.uiHandler.PrintText(groupJID.String() + ": " + offText)
+	}
+}
+
+func (sm *SessionManager) updateCurrentGroupDisappearing(params []string) {
+	groupJID, err := sm.currentGroupJID()
+	if err != nil {
+		sm.uiHandler.PrintError(err)
+		return
+	}
+	if !checkParam(params, 1) {
+		sm.printCommandUsage("disappearing", "off|24h|7d|90d -> in group chat")
+		return
+	}
+	timer, ok := whatsmeow.ParseDisappearingTimerString(strings.Join(params, ""))
+	if !ok {
+		sm.printCommandUsage("disappearing", "off|24h|7d|90d -> in group chat")
+		return
+	}
+	if sm.client == nil || !sm.client.IsConnected() {
+		sm.uiHandler.PrintError(errors.New("not connected to WhatsApp"))
+		return
+	}
+	if err = sm.client.SetDisappearingTimer(context.Background(), groupJID, timer, time.Time{}); err != nil {
+		sm.uiHandler.PrintError(err)
+		return
+	}
+	if timer == whatsmeow.DisappearingTimerOff {
+		sm.uiHandler.PrintText("turned off disappearing messages in " + groupJID.String())
+	} else {
+		sm.uiHandler.PrintText("messages in " + groupJID.String() + " disappear after " + timer.String())
+	}
+}
+
+// parseSwitch reads the on or off parameter of a setting
+func parseSwitch(params []string) (bool, bool) {
+	if len(params) != 1 {
+		return false, false
+	}
+	switch strings.ToLower(params[0]) {
+	case "on", "yes", "true":
+		return true, true
+	case "off", "no", "false":
+		return false, true
+	}
+	return false, false
+}
+
+func (sm *SessionManager) showInviteLink(params []string) {
+	groupJID, err := sm.currentGroupJID()
+	if err != nil {
+		sm.uiHandler.PrintError(err)
+		return
+	}
+	reset := checkParam(params, 1) && params[0] == "--reset"
+	if checkParam(params, 1) && !reset {
+		sm.printCommandUsage("invitelink", "[--reset[] -> in group chat, --reset revokes the old link")
+		return
+	}
+	if sm.client == nil || !sm.client.IsConnected() {
+		sm.uiHandler.PrintError(errors.New("not connected to WhatsApp"))
+		return
+	}
+	link, err := sm.client.GetGroupInviteLink(context.Background(), groupJID, reset)
+	if err != nil {
+		sm.uiHandler.PrintError(err)
+		return
+	}
+	if reset {
+		sm.uiHandler.PrintText("revoked the old invite link of " + groupJID.String())
+	}
+	sm.uiHandler.PrintText("invite link: " + link)
+}
+
+// a group invite link shown by the join command, joined when it is called again
+type groupInvite struct {
+	code string
+	info *types.GroupInfo
+}
+
+// joinGroup shows the group of an invite link, called again without link it
+// joins the group shown last
+func (sm *SessionManager) joinGroup(params []string) {
+	if !checkParam(params, 1) && sm.invite == nil {
+		sm.printCommandUsage("join", "https://chat.whatsapp.com/code -> or only the code, shows the group")
+		return
+	}
+	if sm.client == nil || !sm.client.IsConnected() {
+		sm.uiHandler.PrintError(errors.New("not connected to WhatsApp"))
+		return
+	}
+	if checkParam(params, 1) {
+		sm.previewInvite(inviteCode(strings.Join(params, " ")))
+		return
+	}
+	invite := sm.invite
+	sm.invite = nil
+	info := invite.info
+	groupJID, err := sm.client.JoinGroupWithLink(context.Background(), invite.code)
+	if err != nil {
+		sm.uiHandler.PrintError(err)
+		return
+	}
+	if info.IsJoinApprovalRequired {
+		sm.uiHandler.PrintText("asked the admins of " + groupJID.String() + " to approve joining")
+		return
+	}
+
+	sm.db.AddChat(Chat{
+		Id:          groupJID.String(),
+		IsGroup:     true,
+		Name:        info.Name,
+		LastMessage: time.Now().Unix(),
+	})
+	sm.uiHandler.SetChats(sm.db.GetChatIds())
+	sm.uiHandler.PrintText("joined group " + groupJID.String())
+}
+
+// previewInvite shows the group of an invite code and keeps it for joining
+func (sm *SessionManager) previewInvite(code string) {
+	sm.invite = nil
+	info, err := sm.client.GetGroupInfoFromLink(context.Background(), code)
+	if err != nil {
+		sm.uiHandler.PrintError(fmt.Errorf("invalid invite link: %v", err))
+		return
+	}
+	count := len(info.Participants)
+	if info.ParticipantCount > count {
+		count = info.ParticipantCount
+	}
+	preview := fmt.Sprintf("group [::b]%s[::-] with %d participants", tview.Escape(info.Name), count)
+	if info.Topic != "" {
+		preview += "\n" + tview.Escape(info.Topic)
+	}
+	sm.invite = &groupInvite{code: code, info: info}
+	sm.uiHandler.PrintText(preview + "\n[::b]" + config.Config.General.CmdPrefix + "join[::-] joins it")
+}
+
+// inviteCode returns the code of a group invite link, links may be given
+// with or without scheme
+func inviteCode(link string) string {
+	code := strings.TrimSpace(link)
+	code = strings.TrimPrefix(strings.TrimPrefix(code, "https://"), "http://")
+	code = strings.TrimPrefix(code, strings.TrimPrefix(whatsmeow.InviteLinkPrefix, "https://"))
+	if idx := strings.IndexAny(code, "?#"); idx >= 0 {
+		code = code[:idx]
+	}
+	return strings.TrimSuffix(code, "/")
+}
+
 func (sm *SessionManager) currentGroupJID() (types.JID, error) {
 	if sm.currentReceiver == "" || !strings.Contains(sm.currentReceiver, GROUPSUFFIX) {
 		return types.JID{}, errors.New("not a group")
@@ -807,56 +1561,225 @@ func checkParam(arr []string, length int) bool {
 	return arr != nil && len(arr) >= length
 }
 
-func (sm *SessionManager) getMessages(wid string) []Message {
+// GetMessages returns the stored messages of a chat.
+func (sm *SessionManager) GetMessages(wid string) []Message {
 	return sm.db.GetMessages(wid)
 }
 
-func (sm *SessionManager) sendText(wid, text string) {
-	if sm.client == nil || !sm.client.IsConnected() {
-		sm.uiHandler.PrintError(errors.New("not connected to WhatsApp"))
-		return
+// FuzzyChats returns chats and contacts matching query, best matches first.
+func (sm *SessionManager) FuzzyChats(query string, limit int) []Chat {
+	return sm.db.FuzzyChats(query, limit)
+}
+
+// GetChats returns the stored chats, most recent first.
+func (sm *SessionManager) GetChats() []Chat {
+	return sm.db.GetChatIds()
+}
+
+// SendText sends a text message, it returns once the server has acknowledged it.
+func (sm *SessionManager) SendText(wid, text string) error {
+	raw, text := sm.textMessage(wid, text)
+	return sm.sendTextMessage(wid, raw, text)
+}
+
+func (sm *SessionManager) sendTextMessage(wid string, raw *waProto.Message, text string) error {
+	if _, err := types.ParseJID(wid); err != nil {
+		return fmt.Errorf("invalid JID: %v", err)
 	}
+	return sm.sendOrQueue(OutboxEntry{ChatId: wid, Kind: MessageKindText, Text: text, Raw: raw})
+}
+
+// SendFile sends a file, as image, video or audio message if its type allows
+// and as document otherwise. It returns once the server has acknowledged it.
+func (sm *SessionManager) SendFile(chatID, path string) error {
+	return sm.sendMedia(chatID, path, kindForMimeType(detectMimeType(path, nil)))
+}
 
-	receiver, err := types.ParseJID(wid)
+func (sm *SessionManager) sendMedia(chatID, path string, kind MessageKind) error {
+	if _, err := types.ParseJID(chatID); err != nil {
+		return fmt.Errorf("invalid JID: %v", err)
+	}
+	path, err := filepath.Abs(path)
 	if err != nil {
-		sm.uiHandler.PrintError(fmt.Errorf("invalid JID: %v", err))
-		return
+		return err
+	}
+	if info, err := os.Stat(path); err != nil {
+		return err
+	} else if info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
 	}
+	text := mediaDisplayText(kind, filepath.Base(path), "", 0)
+	return sm.sendOrQueue(OutboxEntry{ChatId: chatID, Kind: kind, Text: text, Path: path})
+}
 
-	raw := &waProto.Message{Conversation: proto.String(text)}
-	sm.lastSent = time.Now()
-	resp, err := sm.client.SendMessage(context.Background(), receiver, raw)
-	if err != nil {
-		sm.uiHandler.PrintError(fmt.Errorf("failed to send message: %v", err))
-		return
+// sendOrQueue sends a message right away. While the manager is running, it is
+// queued in the outbox instead when not connected, when older messages of the
+// chat are still queued or when sending fails for a reason of the connection.
+func (sm *SessionManager) sendOrQueue(entry OutboxEntry) error {
+	connected := sm.client != nil && sm.client.IsConnected()
+	entry.Id = string(sm.client.GenerateMessageID())
+	if sm.outboxTimer == nil {
+		if !connected {
+			return errors.New("not connected to WhatsApp")
+		}
+		msg, err := sm.deliver(entry)
+		removeVoiceFile(entry)
+		if err != nil {
+			return err
+		}
+		sm.showSentMessage(msg)
+		return nil
+	}
+	if connected && !sm.db.HasPendingOutbox(entry.ChatId) {
+		msg, err := sm.deliver(entry)
+		if err == nil {
+			removeVoiceFile(entry)
+			sm.showSentMessage(msg)
+			return nil
+		}
+		if !retryable(err) {
+			removeVoiceFile(entry)
+			return err
+		}
+		entry.Attempts = 1
+		entry.LastError = err.Error()
+		entry.NextAttempt = time.Now().Add(outboxDelay(entry.Attempts)).Unix()
+		sm.uiHandler.PrintError(fmt.Errorf("%v, will retry", err))
 	}
+	sm.queueMessage(entry)
+	return nil
+}
 
-	newMsg := sm.outgoingMessageFromSendResponse(resp, wid, raw, MessageKindText, text, "", "")
-	sm.db.AddMessage(newMsg, false)
-	if sm.currentReceiver == wid {
-		sm.uiHandler.NewMessage(newMsg)
+// queueMessage adds a message to the outbox and shows it as pending in its chat
+func (sm *SessionManager) queueMessage(entry OutboxEntry) {
+	entry.Created = time.Now().Unix()
+	msg := sm.pendingMessage(entry)
+	sm.db.AddOutboxEntry(entry)
+	sm.db.AddMessage(msg, false)
+	if sm.currentReceiver == entry.ChatId {
+		sm.uiHandler.NewMessage(msg)
 	}
 	sm.uiHandler.SetChats(sm.db.GetChatIds())
+	sm.flushOutbox()
 }
 
-func (sm *SessionManager) sendMedia(chatID, path string, kind MessageKind) error {
-	if sm.client == nil || !sm.client.IsConnected() {
-		return errors.New("not connected to WhatsApp")
+func (sm *SessionManager) pendingMessage(entry OutboxEntry) Message {
+	mimeType, fileName := "", ""
+	if entry.Path != "" {
+		fileName = filepath.Base(entry.Path)
+		mimeType = detectMimeType(entry.Path, nil)
+	}
+	resp := whatsmeow.SendResponse{ID: types.MessageID(entry.Id), Timestamp: time.Unix(entry.Created, 0)}
+	msg := sm.outgoingMessageFromSendResponse(resp, entry.ChatId, entry.Raw, entry.Kind, entry.Text, mimeType, fileName)
+	msg.Pending = true
+	msg.SendFailed = entry.Failed
+	return msg
+}
+
+// showSentMessage stores a sent message, replacing its pending message if it was queued
+func (sm *SessionManager) showSentMessage(msg Message) {
+	if _, queued := sm.db.GetMessage(msg.Id); queued {
+		sm.db.ReplaceMessage(msg)
+		if sm.currentReceiver == msg.ChatId {
+			sm.uiHandler.NewScreen(sm.GetMessages(msg.ChatId))
+		}
+	} else {
+		sm.db.AddMessage(msg, false)
+		if sm.currentReceiver == msg.ChatId {
+			sm.uiHandler.NewMessage(msg)
+		}
 	}
+	sm.uiHandler.SetChats(sm.db.GetChatIds())
+}
 
-	data, mimeType, fileName, err := readUploadFile(path)
-	if err != nil {
-		return err
+// outboxDelay returns the time to wait before the next attempt, doubling with each attempt
+func outboxDelay(attempts int) time.Duration {
+	delay := outboxBaseDelay
+	for i := 1; i < attempts && delay < outboxMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > outboxMaxDelay {
+		delay = outboxMaxDelay
+	}
+	return delay
+}
+
+// flushOutbox sends all queued messages that are due, in order. A chat with a
+// message waiting for its retry blocks the following messages of that chat.
+func (sm *SessionManager) flushOutbox() {
+	if sm.outboxTimer == nil || sm.client == nil || !sm.client.IsConnected() {
+		return
+	}
+	now := time.Now()
+	blocked := make(map[string]bool)
+	var next time.Time
+	for _, entry := range sm.db.GetOutbox() {
+		if entry.Failed || blocked[entry.ChatId] {
+			continue
+		}
+		if due := time.Unix(entry.NextAttempt, 0); due.After(now) {
+			blocked[entry.ChatId] = true
+			if next.IsZero() || due.Before(next) {
+				next = due
+			}
+			continue
+		}
+		msg, err := sm.deliver(entry)
+		if err == nil {
+			sm.db.RemoveOutboxEntry(entry.Id)
+			removeVoiceFile(entry)
+			sm.showSentMessage(msg)
+			continue
+		}
+		blocked[entry.ChatId] = true
+		entry.Attempts++
+		entry.LastError = err.Error()
+		if entry.Attempts > config.Config.General.OutboxMaxRetries || !retryable(err) {
+			entry.Failed = true
+			sm.uiHandler.PrintError(fmt.Errorf("giving up sending %s: %v", entry.Id, err))
+		} else {
+			entry.NextAttempt = now.Add(outboxDelay(entry.Attempts)).Unix()
+			if due := time.Unix(entry.NextAttempt, 0); next.IsZero() || due.Before(next) {
+				next = due
+			}
+		}
+		sm.db.UpdateOutboxEntry(entry)
+		if entry.Failed && sm.currentReceiver == entry.ChatId {
+			sm.uiHandler.NewScreen(sm.GetMessages(entry.ChatId))
+		}
+		if !sm.client.IsConnected() {
+			return
+		}
+	}
+	if !next.IsZero() {
+		sm.outboxTimer.Reset(time.Until(next))
 	}
+}
 
-	receiver, err := types.ParseJID(chatID)
+// deliver sends a message of the outbox and returns the sent message
+func (sm *SessionManager) deliver(entry OutboxEntry) (Message, error) {
+	receiver, err := types.ParseJID(entry.ChatId)
 	if err != nil {
-		return fmt.Errorf("invalid JID: %v", err)
+		return Message{}, fmt.Errorf("invalid JID: %v", err)
+	}
+	// messages without attachment are stored ready to send
+	if entry.Raw != nil {
+		sm.lastSent = time.Now()
+		resp, err := sm.client.SendMessage(context.Background(), receiver, entry.Raw, whatsmeow.SendRequestExtra{ID: types.MessageID(entry.Id)})
+		if err != nil {
+			return Message{}, fmt.Errorf("failed to send message: %w", err)
+		}
+		return sm.outgoingMessageFromSendResponse(resp, entry.ChatId, entry.Raw, entry.Kind, entry.Text, "", ""), nil
 	}
 
+	data, mimeType, fileName, err := readUploadFile(entry.Path)
+	if err != nil {
+		return Message{}, err
+	}
+	kind := entry.Kind
 	uploadResp, err := sm.client.Upload(context.Background(), data, uploadMediaType(kind))
 	if err != nil {
-		return fmt.Errorf("failed to upload file: %v", err)
+		return Message{}, fmt.Errorf("failed to upload file: %w", err)
 	}
 
 	fileLength := uploadResp.FileLength
@@ -893,6 +1816,33 @@ func (sm *SessionManager) sendMedia(chatID, path string, kind MessageKind) error
 			FileLength:    &fileLength,
 			PTT:           proto.Bool(false),
 		}
+	case MessageKindVoice:
+		mimeType = voiceMimeType
+		raw.AudioMessage = &waProto.AudioMessage{
+			Mimetype:      proto.String(mimeType),
+			URL:           &uploadResp.URL,
+			DirectPath:    &uploadResp.DirectPath,
+			MediaKey:      uploadResp.MediaKey,
+			FileEncSHA256: uploadResp.FileEncSHA256,
+			FileSHA256:    uploadResp.FileSHA256,
+			FileLength:    &fileLength,
+			Seconds:       proto.Uint32(entry.Seconds),
+			Waveform:      entry.Waveform,
+			PTT:           proto.Bool(true),
+		}
+	case MessageKindSticker:
+		mimeType = "image/webp"
+		raw.StickerMessage = &waProto.StickerMessage{
+			Mimetype:      proto.String(mimeType),
+			URL:           &uploadResp.URL,
+			DirectPath:    &uploadResp.DirectPath,
+			MediaKey:      uploadResp.MediaKey,
+			FileEncSHA256: uploadResp.FileEncSHA256,
+			FileSHA256:    uploadResp.FileSHA256,
+			FileLength:    &fileLength,
+			Width:         proto.Uint32(stickerSize),
+			Height:        proto.Uint32(stickerSize),
+		}
 	case MessageKindDocument:
 		raw.DocumentMessage = &waProto.DocumentMessage{
 			Mimetype:      proto.String(mimeType),
@@ -906,37 +1856,26 @@ func (sm *SessionManager) sendMedia(chatID, path string, kind MessageKind) error
 			FileLength:    &fileLength,
 		}
 	default:
-		return errors.New("unsupported media type")
+		return Message{}, errors.New("unsupported media type")
 	}
 
 	sm.lastSent = time.Now()
-	resp, err := sm.client.SendMessage(context.Background(), receiver, raw)
+	resp, err := sm.client.SendMessage(context.Background(), receiver, raw, whatsmeow.SendRequestExtra{ID: types.MessageID(entry.Id)})
 	if err != nil {
-		return fmt.Errorf("failed to send media message: %v", err)
+		return Message{}, fmt.Errorf("failed to send media message: %w", err)
 	}
-
-	text := mediaDisplayText(kind, fileName, "")
-	newMsg := sm.outgoingMessageFromSendResponse(resp, chatID, raw, kind, text, mimeType, fileName)
-	sm.db.AddMessage(newMsg, false)
-	if sm.currentReceiver == chatID {
-		sm.uiHandler.NewMessage(newMsg)
-	}
-	sm.uiHandler.SetChats(sm.db.GetChatIds())
-	return nil
+	return sm.outgoingMessageFromSendResponse(resp, entry.ChatId, raw, kind, entry.Text, mimeType, fileName), nil
 }
 
 func (sm *SessionManager) outgoingMessageFromSendResponse(resp whatsmeow.SendResponse, chatID string, raw *waProto.Message, kind MessageKind, text, mimeType, fileName string) Message {
-	selfID := ""
-	if sm.client != nil && sm.client.Store != nil && sm.client.Store.ID != nil {
-		selfID = sm.client.Store.ID.String()
-	}
+	selfID := sm.selfID()
 
 	contactID := chatID
 	if strings.Contains(chatID, GROUPSUFFIX) {
 		contactID = selfID
 	}
 
-	return Message{
+	msg := Message{
 		Id:           string(resp.ID),
 		ChatId:       chatID,
 		SenderId:     selfID,
@@ -951,6 +1890,48 @@ func (sm *SessionManager) outgoingMessageFromSendResponse(resp whatsmeow.SendRes
 		FileName:     fileName,
 		RawMessage:   raw,
 	}
+	sm.eventHandler.applyQuote(&msg, messageContextInfo(raw))
+	sm.eventHandler.applyMentions(&msg, messageContextInfo(raw))
+	return msg
+}
+
+// selfID returns our own user ID, or an empty string when not logged in
+func (sm *SessionManager) selfID() string {
+	if sm.client != nil && sm.client.Store != nil && sm.client.Store.ID != nil {
+		return sm.client.Store.ID.ToNonAD().String()
+	}
+	return ""
+}
+
+// messageSender returns the user that sent a message, without device part
+func messageSender(msg Message) types.JID {
+	sender := msg.SenderId
+	if sender == "" {
+		sender = msg.ContactId
+	}
+	jid, err := types.ParseJID(sender)
+	if err != nil {
+		return types.EmptyJID
+	}
+	return jid.ToNonAD()
+}
+
+// replyMessage builds a text message that quotes the given message
+func replyMessage(quoted Message, text string) *waProto.Message {
+	quotedRaw := quoted.RawMessage
+	if quotedRaw == nil {
+		quotedRaw = &waProto.Message{Conversation: proto.String(quoted.Text)}
+	}
+	return &waProto.Message{
+		ExtendedTextMessage: &waProto.ExtendedTextMessage{
+			Text: proto.String(text),
+			ContextInfo: &waProto.ContextInfo{
+				StanzaID:      proto.String(quoted.Id),
+				Participant:   proto.String(messageSender(quoted).String()),
+				QuotedMessage: quotedRaw,
+			},
+		},
+	}
 }
 
 func notify(title, message string) error {
@@ -973,16 +1954,49 @@ func (eh *eventHandler) Handle(evt interface{}) {
 		eh.handleLiveMessage(v)
 	case *events.HistorySync:
 		eh.handleHistorySync(v)
+	case *events.Receipt:
+		eh.handleReceipt(v)
+	case *events.GroupInfo:
+		eh.handleGroupInfo(v)
+	case *events.JoinedGroup:
+		eh.handleJoinedGroup(v)
+	case *events.ChatPresence, *events.Presence:
+		eh.sm.queuePresence(v)
+	case *events.OfflineSyncCompleted:
+		select {
+		case eh.sm.offlineSynced <- struct{}{}:
+		default:
+		}
 	case *events.Connected:
-		eh.sm.StatusChannel <- StatusMsg{true, nil}
+		eh.sm.queueStatus(StatusMsg{true, nil})
 	case *events.Disconnected:
-		eh.sm.StatusChannel <- StatusMsg{false, nil}
+		eh.sm.queueStatus(StatusMsg{false, nil})
 	case *events.LoggedOut:
-		eh.sm.StatusChannel <- StatusMsg{false, nil}
+		eh.sm.queueStatus(StatusMsg{false, nil})
 		eh.sm.uiHandler.PrintText("Logged out: " + fmt.Sprintf("%v", v.Reason))
 	}
 }
 
+// queueStatus passes a connection change to the manager routine. Without
+// the routine, as in one-shot use, nothing reads the channel, so events that
+// do not fit are dropped instead of blocking the event handler. The manager
+// reads the connection state from the client anyway.
+func (sm *SessionManager) queueStatus(msg StatusMsg) {
+	select {
+	case sm.StatusChannel <- msg:
+	default:
+	}
+}
+
+// queuePresence passes a presence event to the manager routine, dropping it
+// when the channel is full like queueStatus
+func (sm *SessionManager) queuePresence(evt interface{}) {
+	select {
+	case sm.PresenceChannel <- evt:
+	default:
+	}
+}
+
 func (eh *eventHandler) handleLiveMessage(evt *events.Message) {
 	msg, action, ok := eh.normalizeEventMessage(evt)
 	if !ok {
@@ -992,10 +2006,41 @@ func (eh *eventHandler) handleLiveMessage(evt *events.Message) {
 	switch action {
 	case "revoke":
 		if eh.sm.db.MarkMessageRevoked(msg.Id) && eh.sm.currentReceiver == msg.ChatId {
-			eh.sm.uiHandler.NewScreen(eh.sm.getMessages(msg.ChatId))
+			eh.sm.uiHandler.NewScreen(eh.sm.GetMessages(msg.ChatId))
 		}
 		eh.sm.uiHandler.SetChats(eh.sm.db.GetChatIds())
 		return
+	case "react":
+		if eh.sm.db.SetReaction(msg.Id, reactionFromMessage(msg)) && eh.sm.currentReceiver == msg.ChatId {
+			eh.sm.uiHandler.NewScreen(eh.sm.GetMessages(msg.ChatId))
+		}
+		return
+	case "edit":
+		if eh.applyEdit(msg) && eh.sm.currentReceiver == msg.ChatId {
+			eh.sm.uiHandler.NewScreen(eh.sm.GetMessages(msg.ChatId))
+		}
+		return
+	case "live":
+		if eh.sm.db.UpdateLiveLocation(msg) {
+			if eh.sm.currentReceiver == msg.ChatId {
+				eh.sm.uiHandler.NewScreen(eh.sm.GetMessages(msg.ChatId))
+			}
+			return
+		}
+	case "vote":
+		// votes on polls from before the login can not be decrypted
+		if _, known := eh.sm.db.GetMessage(msg.Id); !known {
+			return
+		}
+		vote, err := eh.pollVote(evt)
+		if err != nil {
+			eh.sm.uiHandler.PrintError(err)
+			return
+		}
+		if eh.sm.db.SetPollVote(msg.Id, vote) && eh.sm.currentReceiver == msg.ChatId {
+			eh.sm.uiHandler.NewScreen(eh.sm.GetMessages(msg.ChatId))
+		}
+		return
 	case "ignore":
 		return
 	}
@@ -1006,7 +2051,7 @@ func (eh *eventHandler) handleLiveMessage(evt *events.Message) {
 		if isNew {
 			eh.sm.uiHandler.NewMessage(msg)
 		} else {
-			eh.sm.uiHandler.NewScreen(eh.sm.getMessages(msg.ChatId))
+			eh.sm.uiHandler.NewScreen(eh.sm.GetMessages(msg.ChatId))
 		}
 	} else if markUnread && msg.Timestamp > uint64(time.Now().Unix()-30) {
 		if err := notify(msg.ContactShort, msg.Text); err != nil {
@@ -1016,6 +2061,72 @@ func (eh *eventHandler) handleLiveMessage(evt *events.Message) {
 	eh.sm.uiHandler.SetChats(eh.sm.db.GetChatIds())
 }
 
+func (eh *eventHandler) handleReceipt(evt *events.Receipt) {
+	if evt.IsFromMe {
+		return
+	}
+	var state ReceiptState
+	switch evt.Type {
+	case types.ReceiptTypeDelivered:
+		state = ReceiptDelivered
+	case types.ReceiptTypeRead:
+		state = ReceiptRead
+	case types.ReceiptTypePlayed:
+		state = ReceiptPlayed
+	default:
+		return
+	}
+	receipt := Receipt{
+		ParticipantId: evt.Sender.ToNonAD().String(),
+		State:         state,
+		Timestamp:     uint64(evt.Timestamp.Unix()),
+	}
+	changed := false
+	for _, id := range evt.MessageIDs {
+		changed = eh.sm.db.SetReceipt(string(id), receipt) || changed
+	}
+	if changed && eh.sm.currentReceiver == evt.Chat.String() {
+		eh.sm.uiHandler.NewScreen(eh.sm.GetMessages(evt.Chat.String()))
+	}
+}
+
+// applyHistoryReceipts stores the receipts of an own message from the history sync
+func (eh *eventHandler) applyHistoryReceipts(msg Message, webMsg *waWeb.WebMessageInfo) {
+	for _, userReceipt := range webMsg.GetUserReceipt() {
+		receipt := Receipt{ParticipantId: userReceipt.GetUserJID()}
+		if jid, err := types.ParseJID(receipt.ParticipantId); err == nil {
+			receipt.ParticipantId = jid.ToNonAD().String()
+		}
+		switch {
+		case userReceipt.GetPlayedTimestamp() != 0:
+			receipt.State, receipt.Timestamp = ReceiptPlayed, uint64(userReceipt.GetPlayedTimestamp())
+		case userReceipt.GetReadTimestamp() != 0:
+			receipt.State, receipt.Timestamp = ReceiptRead, uint64(userReceipt.GetReadTimestamp())
+		case userReceipt.GetReceiptTimestamp() != 0:
+			receipt.State, receipt.Timestamp = ReceiptDelivered, uint64(userReceipt.GetReceiptTimestamp())
+		default:
+			continue
+		}
+		eh.sm.db.SetReceipt(msg.Id, receipt)
+	}
+	if len(webMsg.GetUserReceipt()) > 0 || strings.HasSuffix(msg.ChatId, GROUPSUFFIX) {
+		return
+	}
+	// single chats often only have the overall status
+	receipt := Receipt{ParticipantId: msg.ChatId}
+	switch webMsg.GetStatus() {
+	case waWeb.WebMessageInfo_DELIVERY_ACK:
+		receipt.State = ReceiptDelivered
+	case waWeb.WebMessageInfo_READ:
+		receipt.State = ReceiptRead
+	case waWeb.WebMessageInfo_PLAYED:
+		receipt.State = ReceiptPlayed
+	default:
+		return
+	}
+	eh.sm.db.SetReceipt(msg.Id, receipt)
+}
+
 func (eh *eventHandler) handleHistorySync(evt *events.HistorySync) {
 	if evt == nil || evt.Data == nil {
 		return
@@ -1065,18 +2176,49 @@ func (eh *eventHandler) handleHistorySync(evt *events.HistorySync) {
 				continue
 			}
 			msg, action, ok := eh.normalizeEventMessage(parsed)
-			if !ok || action != "" {
+			if !ok {
 				continue
 			}
-			eh.sm.db.AddMessage(msg, false)
+			switch action {
+			case "live":
+				if !eh.sm.db.UpdateLiveLocation(msg) {
+					eh.sm.db.AddMessage(msg, false)
+				}
+			case "":
+				eh.sm.db.AddMessage(msg, false)
+				if msg.FromMe {
+					eh.applyHistoryReceipts(msg, webMsg)
+				}
+			case "react":
+				eh.sm.db.SetReaction(msg.Id, reactionFromMessage(msg))
+			case "edit":
+				eh.applyEdit(msg)
+			case "vote":
+				if vote, err := eh.pollVote(parsed); err == nil {
+					eh.sm.db.SetPollVote(msg.Id, vote)
+				}
+			}
 		}
 		eh.sm.db.UpdateChatUnread(chatID, int(conv.GetUnreadCount()))
 	}
 
 	eh.sm.uiHandler.SetChats(eh.sm.db.GetChatIds())
 	if eh.sm.currentReceiver != "" {
-		eh.sm.uiHandler.NewScreen(eh.sm.getMessages(eh.sm.currentReceiver))
+		eh.sm.uiHandler.NewScreen(eh.sm.GetMessages(eh.sm.currentReceiver))
+	}
+}
+
+// applyEdit changes the text of a stored message. Edits refer to the message
+// by id only, so edits by anyone but the sender of the message are ignored.
+func (eh *eventHandler) applyEdit(edit Message) bool {
+	msg, ok := eh.sm.db.GetMessage(edit.Id)
+	if !ok || msg.ChatId != edit.ChatId || msg.FromMe != edit.FromMe {
+		return false
+	}
+	if !msg.FromMe && strings.HasSuffix(msg.ChatId, GROUPSUFFIX) && messageSender(msg).User != messageSender(edit).User {
+		return false
 	}
+	return eh.sm.db.EditMessage(edit.Id, edit.Text, edit.Timestamp)
 }
 
 func (eh *eventHandler) normalizeEventMessage(evt *events.Message) (Message, string, bool) {
@@ -1091,10 +2233,56 @@ func (eh *eventHandler) normalizeEventMessage(evt *events.Message) (Message, str
 				ChatId: evt.Info.Chat.String(),
 			}, "revoke", true
 		}
+		if protocol.GetType() == waProto.ProtocolMessage_MESSAGE_EDIT && protocol.GetKey() != nil {
+			timestamp := evt.Info.Timestamp.Unix()
+			if protocol.GetTimestampMS() > 0 {
+				timestamp = protocol.GetTimestampMS() / 1000
+			}
+			return Message{
+				Id:        protocol.GetKey().GetID(),
+				ChatId:    evt.Info.Chat.String(),
+				SenderId:  evt.Info.Sender.ToNonAD().String(),
+				FromMe:    evt.Info.IsFromMe,
+				Timestamp: uint64(timestamp),
+				Text:      messageBodyText(protocol.GetEditedMessage()),
+			}, "edit", true
+		}
 		return Message{}, "ignore", false
 	}
 
+	// reactions refer to the message they react to, with the emoji as text
+	if reaction := evt.Message.GetReactionMessage(); reaction != nil {
+		if reaction.GetKey() == nil {
+			return Message{}, "ignore", false
+		}
+		timestamp := evt.Info.Timestamp.Unix()
+		if reaction.GetSenderTimestampMS() > 0 {
+			timestamp = reaction.GetSenderTimestampMS() / 1000
+		}
+		return Message{
+			Id:        reaction.GetKey().GetID(),
+			ChatId:    evt.Info.Chat.String(),
+			SenderId:  evt.Info.Sender.ToNonAD().String(),
+			Timestamp: uint64(timestamp),
+			Text:      reaction.GetText(),
+		}, "react", true
+	}
+
+	// votes refer to the poll, the chosen options are decrypted by the caller
+	if update := evt.Message.GetPollUpdateMessage(); update != nil {
+		if update.GetPollCreationMessageKey() == nil {
+			return Message{}, "ignore", false
+		}
+		return Message{
+			Id:     update.GetPollCreationMessageKey().GetID(),
+			ChatId: evt.Info.Chat.String(),
+		}, "vote", true
+	}
+
 	msg, ok := eh.messageFromInfo(evt.Info, evt.Message)
+	if ok && evt.Message.GetLiveLocationMessage() != nil {
+		return msg, "live", true
+	}
 	return msg, "", ok
 }
 
@@ -1120,6 +2308,8 @@ func (eh *eventHandler) messageFromInfo(info types.MessageInfo, raw *waProto.Mes
 		FromMe:       info.IsFromMe,
 		RawMessage:   raw,
 	}
+	eh.applyQuote(&msg, messageContextInfo(raw))
+	eh.applyMentions(&msg, messageContextInfo(raw))
 
 	switch {
 	case raw.GetConversation() != "":
@@ -1136,21 +2326,24 @@ func (eh *eventHandler) messageFromInfo(info types.MessageInfo, raw *waProto.Mes
 		image := raw.GetImageMessage()
 		msg.Kind = MessageKindImage
 		msg.MimeType = image.GetMimetype()
-		msg.Text = mediaDisplayText(MessageKindImage, "", image.GetCaption())
+		msg.Text = mediaDisplayText(MessageKindImage, "", image.GetCaption(), 0)
 		msg.Forwarded = image.GetContextInfo().GetIsForwarded()
 		return msg, true
 	case raw.GetVideoMessage() != nil:
 		video := raw.GetVideoMessage()
 		msg.Kind = MessageKindVideo
 		msg.MimeType = video.GetMimetype()
-		msg.Text = mediaDisplayText(MessageKindVideo, "", video.GetCaption())
+		msg.Text = mediaDisplayText(MessageKindVideo, "", video.GetCaption(), video.GetSeconds())
 		msg.Forwarded = video.GetContextInfo().GetIsForwarded()
 		return msg, true
 	case raw.GetAudioMessage() != nil:
 		audio := raw.GetAudioMessage()
 		msg.Kind = MessageKindAudio
+		if audio.GetPTT() {
+			msg.Kind = MessageKindVoice
+		}
 		msg.MimeType = audio.GetMimetype()
-		msg.Text = mediaDisplayText(MessageKindAudio, "", "")
+		msg.Text = mediaDisplayText(msg.Kind, "", "", audio.GetSeconds())
 		msg.Forwarded = audio.GetContextInfo().GetIsForwarded()
 		return msg, true
 	case raw.GetDocumentMessage() != nil:
@@ -1158,14 +2351,75 @@ func (eh *eventHandler) messageFromInfo(info types.MessageInfo, raw *waProto.Mes
 		msg.Kind = MessageKindDocument
 		msg.MimeType = doc.GetMimetype()
 		msg.FileName = doc.GetFileName()
-		msg.Text = mediaDisplayText(MessageKindDocument, doc.GetFileName(), doc.GetCaption())
+		msg.Text = mediaDisplayText(MessageKindDocument, doc.GetFileName(), doc.GetCaption(), 0)
 		msg.Forwarded = doc.GetContextInfo().GetIsForwarded()
 		return msg, true
+	case raw.GetContactMessage() != nil, raw.GetContactsArrayMessage() != nil:
+		msg.Kind = MessageKindContact
+		msg.Text = contactCardText(raw)
+		msg.Forwarded = messageContextInfo(raw).GetIsForwarded()
+		return msg, true
+	case raw.GetLocationMessage() != nil:
+		loc := raw.GetLocationMessage()
+		msg.Kind = MessageKindLocation
+		msg.Text = locationText(loc)
+		msg.Forwarded = loc.GetContextInfo().GetIsForwarded()
+		return msg, true
+	case raw.GetLiveLocationMessage() != nil:
+		msg.Kind = MessageKindLocation
+		msg.Text = liveLocationText(raw.GetLiveLocationMessage(), info.Timestamp)
+		return msg, true
+	case pollCreation(raw) != nil:
+		poll := pollCreation(raw)
+		msg.Kind = MessageKindPoll
+		msg.Text = pollText(poll)
+		msg.Forwarded = poll.GetContextInfo().GetIsForwarded()
+		return msg, true
+	case raw.GetStickerMessage() != nil:
+		sticker := raw.GetStickerMessage()
+		msg.Kind = MessageKindSticker
+		msg.MimeType = sticker.GetMimetype()
+		msg.Text = mediaDisplayText(MessageKindSticker, "", sticker.GetEmojis(), 0)
+		msg.Forwarded = sticker.GetContextInfo().GetIsForwarded()
+		return msg, true
 	default:
 		return Message{}, false
 	}
 }
 
+func reactionFromMessage(msg Message) Reaction {
+	return Reaction{
+		SenderId:  msg.SenderId,
+		Emoji:     msg.Text,
+		Timestamp: msg.Timestamp,
+	}
+}
+
+// applyQuote fills in the quoted message of a reply, preferring the stored
+// version of the quoted message over the copy embedded in the reply
+func (eh *eventHandler) applyQuote(msg *Message, ctx *waProto.ContextInfo) {
+	if ctx.GetStanzaID() == "" {
+		return
+	}
+	msg.QuotedId = ctx.GetStanzaID()
+	if quoted, ok := eh.sm.db.GetMessage(msg.QuotedId); ok {
+		msg.QuotedName = quoted.ContactShort
+		if quoted.FromMe {
+			msg.QuotedName = "Me"
+		}
+		msg.QuotedText = quoted.Text
+		return
+	}
+	msg.QuotedText = messageBodyText(ctx.GetQuotedMessage())
+	if participant, err := types.ParseJID(ctx.GetParticipant()); err == nil {
+		if participant.ToNonAD().String() == eh.sm.selfID() {
+			msg.QuotedName = "Me"
+		} else {
+			msg.QuotedName = eh.getContactShort(participant)
+		}
+	}
+}
+
 func (eh *eventHandler) contactForMessage(info types.MessageInfo) (string, string, string) {
 	if info.IsGroup {
 		id := info.Sender.String()
@@ -1201,7 +2455,102 @@ func (eh *eventHandler) getContactShort(jid types.JID) string {
 	return eh.sm.db.GetIdShort(jid.String())
 }
 
+// messageContextInfo returns the context info of messages that can carry one
+func messageContextInfo(raw *waProto.Message) *waProto.ContextInfo {
+	switch {
+	case raw.GetExtendedTextMessage() != nil:
+		return raw.GetExtendedTextMessage().GetContextInfo()
+	case raw.GetImageMessage() != nil:
+		return raw.GetImageMessage().GetContextInfo()
+	case raw.GetVideoMessage() != nil:
+		return raw.GetVideoMessage().GetContextInfo()
+	case raw.GetAudioMessage() != nil:
+		return raw.GetAudioMessage().GetContextInfo()
+	case raw.GetDocumentMessage() != nil:
+		return raw.GetDocumentMessage().GetContextInfo()
+	case raw.GetStickerMessage() != nil:
+		return raw.GetStickerMessage().GetContextInfo()
+	case raw.GetContactMessage() != nil:
+		return raw.GetContactMessage().GetContextInfo()
+	case raw.GetContactsArrayMessage() != nil:
+		return raw.GetContactsArrayMessage().GetContextInfo()
+	case raw.GetLocationMessage() != nil:
+		return raw.GetLocationMessage().GetContextInfo()
+	case raw.GetLiveLocationMessage() != nil:
+		return raw.GetLiveLocationMessage().GetContextInfo()
+	case pollCreation(raw) != nil:
+		return pollCreation(raw).GetContextInfo()
+	}
+	return nil
+}
+
+// messageBodyText returns the display text for message content embedded in
+// replies and edits
+func messageBodyText(raw *waProto.Message) string {
+	switch {
+	case raw.GetConversation() != "":
+		return raw.GetConversation()
+	case raw.GetExtendedTextMessage() != nil:
+		return raw.GetExtendedTextMessage().GetText()
+	case raw.GetImageMessage() != nil:
+		return mediaDisplayText(MessageKindImage, "", raw.GetImageMessage().GetCaption(), 0)
+	case raw.GetVideoMessage() != nil:
+		return mediaDisplayText(MessageKindVideo, "", raw.GetVideoMessage().GetCaption(), raw.GetVideoMessage().GetSeconds())
+	case raw.GetAudioMessage() != nil:
+		audio := raw.GetAudioMessage()
+		if audio.GetPTT() {
+			return mediaDisplayText(MessageKindVoice, "", "", audio.GetSeconds())
+		}
+		return mediaDisplayText(MessageKindAudio, "", "", audio.GetSeconds())
+	case raw.GetDocumentMessage() != nil:
+		doc := raw.GetDocumentMessage()
+		return mediaDisplayText(MessageKindDocument, doc.GetFileName(), doc.GetCaption(), 0)
+	case raw.GetStickerMessage() != nil:
+		return mediaDisplayText(MessageKindSticker, "", raw.GetStickerMessage().GetEmojis(), 0)
+	case raw.GetContactMessage() != nil, raw.GetContactsArrayMessage() != nil:
+		return contactCardText(raw)
+	case raw.GetLocationMessage() != nil:
+		return locationText(raw.GetLocationMessage())
+	case raw.GetLiveLocationMessage() != nil:
+		return "[LIVE LOCATION]"
+	case pollCreation(raw) != nil:
+		return pollText(pollCreation(raw))
+	}
+	return ""
+}
+
+// messageCaption returns the caption of an attachment
+func messageCaption(raw *waProto.Message) string {
+	switch {
+	case raw.GetImageMessage() != nil:
+		return raw.GetImageMessage().GetCaption()
+	case raw.GetVideoMessage() != nil:
+		return raw.GetVideoMessage().GetCaption()
+	case raw.GetDocumentMessage() != nil:
+		return raw.GetDocumentMessage().GetCaption()
+	}
+	return ""
+}
+
 func (sm *SessionManager) downloadMessage(msg Message, preview bool) (string, error) {
+	baseDir := config.Config.General.DownloadPath
+	if preview {
+		baseDir = config.Config.General.PreviewPath
+	}
+	return sm.downloadMessageTo(msg, baseDir)
+}
+
+// downloadMessageTo downloads the attachment of a message into baseDir, unless it exists already
+func (sm *SessionManager) downloadMessageTo(msg Message, baseDir string) (string, error) {
+	if msg.LocalPath != "" {
+		if _, err := os.Stat(msg.LocalPath); err != nil {
+			return "", fmt.Errorf("imported attachment not found: %s", msg.LocalPath)
+		}
+		return msg.LocalPath, nil
+	}
+	if msg.Kind == MessageKindContact {
+		return saveContactCard(msg, baseDir)
+	}
 	if sm.client == nil || !sm.client.IsConnected() {
 		return "", errors.New("not connected to WhatsApp")
 	}
@@ -1211,10 +2560,6 @@ func (sm *SessionManager) downloadMessage(msg Message, preview bool) (string, er
 		return "", err
 	}
 
-	baseDir := config.Config.General.DownloadPath
-	if preview {
-		baseDir = config.Config.General.PreviewPath
-	}
 	if err = os.MkdirAll(baseDir, 0o755); err != nil {
 		return "", err
 	}
@@ -1248,7 +2593,7 @@ func downloadableFromMessage(msg Message) (whatsmeow.DownloadableMessage, error)
 		if media := msg.RawMessage.GetVideoMessage(); media != nil {
 			return media, nil
 		}
-	case MessageKindAudio:
+	case MessageKindAudio, MessageKindVoice:
 		if media := msg.RawMessage.GetAudioMessage(); media != nil {
 			return media, nil
 		}
@@ -1256,6 +2601,10 @@ func downloadableFromMessage(msg Message) (whatsmeow.DownloadableMessage, error)
 		if media := msg.RawMessage.GetDocumentMessage(); media != nil {
 			return media, nil
 		}
+	case MessageKindSticker:
+		if media := msg.RawMessage.GetStickerMessage(); media != nil {
+			return media, nil
+		}
 	}
 	return nil, errors.New("This is not a downloadable message")
 }
@@ -1316,17 +2665,30 @@ func downloadFileName(msg Message) string {
 
 func uploadMediaType(kind MessageKind) whatsmeow.MediaType {
 	switch kind {
-	case MessageKindImage:
+	case MessageKindImage, MessageKindSticker:
 		return whatsmeow.MediaImage
 	case MessageKindVideo:
 		return whatsmeow.MediaVideo
-	case MessageKindAudio:
+	case MessageKindAudio, MessageKindVoice:
 		return whatsmeow.MediaAudio
 	default:
 		return whatsmeow.MediaDocument
 	}
 }
 
+func kindForMimeType(mimeType string) MessageKind {
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return MessageKindImage
+	case strings.HasPrefix(mimeType, "video/"):
+		return MessageKindVideo
+	case strings.HasPrefix(mimeType, "audio/"):
+		return MessageKindAudio
+	default:
+		return MessageKindDocument
+	}
+}
+
 func commandNameForKind(kind MessageKind) string {
 	switch kind {
 	case MessageKindImage:
@@ -1335,12 +2697,18 @@ func commandNameForKind(kind MessageKind) string {
 		return "sendvideo"
 	case MessageKindAudio:
 		return "sendaudio"
+	case MessageKindVoice:
+		return "voice"
+	case MessageKindSticker:
+		return "sendsticker"
 	default:
 		return "upload"
 	}
 }
 
-func mediaDisplayText(kind MessageKind, fileName, caption string) string {
+// mediaDisplayText returns the text shown for an attachment, the duration is
+// shown for audio and video if known
+func mediaDisplayText(kind MessageKind, fileName, caption string, seconds uint32) string {
 	label := "[FILE]"
 	switch kind {
 	case MessageKindImage:
@@ -1349,10 +2717,17 @@ func mediaDisplayText(kind MessageKind, fileName, caption string) string {
 		label = "[VIDEO]"
 	case MessageKindAudio:
 		label = "[AUDIO]"
+	case MessageKindVoice:
+		label = "[VOICE]"
+	case MessageKindSticker:
+		label = "[STICKER]"
 	case MessageKindDocument:
 		label = "[DOCUMENT]"
 	}
 	parts := []string{label}
+	if seconds > 0 {
+		parts = append(parts, formatDuration(seconds))
+	}
 	if fileName != "" && kind == MessageKindDocument {
 		parts = append(parts, fileName)
 	}
@@ -1,6 +1,18 @@
 package messages
 
-import "testing"
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adrg/xdg"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/proto/waCommon"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
 
 func TestDownloadFileNameSanitizesPathTraversal(t *testing.T) {
 	msg := Message{
@@ -38,3 +50,226 @@ func TestDownloadFileNameFallsBackForInvalidName(t *testing.T) {
 		t.Fatalf("expected fallback filename, got %q", got)
 	}
 }
+
+func TestReplyMessageQuotesOriginal(t *testing.T) {
+	quoted := Message{
+		Id:       "msg-1",
+		ChatId:   "group@g.us",
+		SenderId: "123:4@s.whatsapp.net",
+		Text:     "hello",
+	}
+
+	raw := replyMessage(quoted, "hi back")
+	ctx := raw.GetExtendedTextMessage().GetContextInfo()
+	if raw.GetExtendedTextMessage().GetText() != "hi back" {
+		t.Fatalf("unexpected reply text %q", raw.GetExtendedTextMessage().GetText())
+	}
+	if ctx.GetStanzaID() != "msg-1" || ctx.GetParticipant() != "123@s.whatsapp.net" {
+		t.Fatalf("unexpected context info: %v", ctx)
+	}
+	if ctx.GetQuotedMessage().GetConversation() != "hello" {
+		t.Fatalf("expected quoted text fallback, got %v", ctx.GetQuotedMessage())
+	}
+}
+
+func TestMessageFromInfoParsesQuote(t *testing.T) {
+	db := &MessageDatabase{}
+	db.Init()
+	eh := &eventHandler{sm: &SessionManager{db: db}}
+
+	chat := types.NewJID("123", types.DefaultUserServer)
+	raw := replyMessage(Message{Id: "unknown", SenderId: chat.String(), Text: "original"}, "answer")
+	msg, ok := eh.messageFromInfo(types.MessageInfo{
+		MessageSource: types.MessageSource{Chat: chat, Sender: chat},
+		ID:            "msg-2",
+		Timestamp:     time.Unix(100, 0),
+	}, raw)
+	if !ok {
+		t.Fatal("expected reply to be parsed")
+	}
+	if msg.Text != "answer" || msg.QuotedId != "unknown" || msg.QuotedText != "original" || msg.QuotedName != "123" {
+		t.Fatalf("unexpected quote: %#v", msg)
+	}
+
+	db.AddMessage(Message{Id: "stored", ChatId: chat.String(), ContactShort: "Alice", Text: "stored text"}, false)
+	raw = replyMessage(Message{Id: "stored", SenderId: chat.String(), Text: "embedded"}, "answer")
+	msg, _ = eh.messageFromInfo(types.MessageInfo{
+		MessageSource: types.MessageSource{Chat: chat, Sender: chat},
+		ID:            "msg-3",
+	}, raw)
+	if msg.QuotedName != "Alice" || msg.QuotedText != "stored text" {
+		t.Fatalf("expected stored message to be quoted, got %#v", msg)
+	}
+}
+
+func TestNormalizeEventMessageParsesEdit(t *testing.T) {
+	db := &MessageDatabase{}
+	db.Init()
+	eh := &eventHandler{sm: &SessionManager{db: db}}
+
+	chat := types.NewJID("123", types.DefaultUserServer)
+	msg, action, ok := eh.normalizeEventMessage(&events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: chat, Sender: chat},
+			ID:            "edit-1",
+			Timestamp:     time.Unix(200, 0),
+		},
+		Message: &waProto.Message{
+			ProtocolMessage: &waProto.ProtocolMessage{
+				Type:          waProto.ProtocolMessage_MESSAGE_EDIT.Enum(),
+				Key:           &waCommon.MessageKey{ID: proto.String("msg-1")},
+				EditedMessage: &waProto.Message{Conversation: proto.String("fixed")},
+				TimestampMS:   proto.Int64(150000),
+			},
+		},
+	})
+	if !ok || action != "edit" {
+		t.Fatalf("expected edit action, got %q", action)
+	}
+	if msg.Id != "msg-1" || msg.Text != "fixed" || msg.Timestamp != 150 || msg.ChatId != chat.String() {
+		t.Fatalf("unexpected edit: %#v", msg)
+	}
+}
+
+func TestEditBySomeoneElseIsIgnored(t *testing.T) {
+	sm := &SessionManager{}
+	sm.Init(&backgroundUi{})
+	group := types.NewJID("group", types.GroupServer)
+	alice := types.NewJID("111", types.DefaultUserServer)
+	mallory := types.NewJID("222", types.DefaultUserServer)
+	sm.db.AddMessage(Message{Id: "msg-1", ChatId: group.String(), SenderId: alice.String() + ":3", Timestamp: 100, Text: "original"}, false)
+
+	edit := func(sender types.JID, text string, timestamp int64) {
+		sm.eventHandler.Handle(&events.Message{
+			Info: types.MessageInfo{
+				MessageSource: types.MessageSource{Chat: group, Sender: sender, IsGroup: true},
+				ID:            types.MessageID("edit-" + text),
+				Timestamp:     time.Unix(timestamp, 0),
+			},
+			Message: &waProto.Message{
+				ProtocolMessage: &waProto.ProtocolMessage{
+					Type:          waProto.ProtocolMessage_MESSAGE_EDIT.Enum(),
+					Key:           &waCommon.MessageKey{ID: proto.String("msg-1")},
+					EditedMessage: &waProto.Message{Conversation: proto.String(text)},
+				},
+			},
+		})
+	}
+	edit(mallory, "spoofed", 110)
+	if msg, _ := sm.db.GetMessage("msg-1"); msg.Text != "original" {
+		t.Fatalf("expected the edit of another member to be ignored, got %q", msg.Text)
+	}
+	edit(alice, "fixed", 120)
+	if msg, _ := sm.db.GetMessage("msg-1"); msg.Text != "fixed" {
+		t.Fatalf("expected the edit of the sender to be applied, got %q", msg.Text)
+	}
+}
+
+func TestInviteCode(t *testing.T) {
+	for link, expected := range map[string]string{
+		"https://chat.whatsapp.com/AbCdEf123":     "AbCdEf123",
+		" chat.whatsapp.com/AbCdEf123/ ":          "AbCdEf123",
+		"http://chat.whatsapp.com/AbCdEf123?lang": "AbCdEf123",
+		"AbCdEf123": "AbCdEf123",
+	} {
+		if code := inviteCode(link); code != expected {
+			t.Fatalf("inviteCode(%q) = %q, expected %q", link, code, expected)
+		}
+	}
+}
+
+func TestParseSwitch(t *testing.T) {
+	if on, ok := parseSwitch([]string{"On"}); !on || !ok {
+		t.Fatal("expected on")
+	}
+	if on, ok := parseSwitch([]string{"off"}); on || !ok {
+		t.Fatal("expected off")
+	}
+	if _, ok := parseSwitch([]string{"maybe"}); ok {
+		t.Fatal("expected unknown value to be rejected")
+	}
+	if _, ok := parseSwitch(nil); ok {
+		t.Fatal("expected missing value to be rejected")
+	}
+}
+
+func TestOfflineSyncCompletedIsSignaledOnce(t *testing.T) {
+	sm := &SessionManager{}
+	sm.Init(nil)
+	sm.eventHandler.Handle(&events.OfflineSyncCompleted{Count: 3})
+	sm.eventHandler.Handle(&events.OfflineSyncCompleted{})
+	select {
+	case <-sm.offlineSynced:
+	default:
+		t.Fatal("expected offline sync to be signaled")
+	}
+	select {
+	case <-sm.offlineSynced:
+		t.Fatal("expected a single pending signal")
+	default:
+	}
+}
+
+func TestConnectWithoutLoginFailsFast(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	xdg.Reload()
+	defer xdg.Reload()
+	sm := &SessionManager{Account: "cli"}
+	sm.Init(nil)
+	start := time.Now()
+	err := sm.Connect(10 * time.Second)
+	sm.Close()
+	if err == nil || !strings.Contains(err.Error(), "log in first") || time.Since(start) > 5*time.Second {
+		t.Fatalf("expected quick login error, got %v", err)
+	}
+}
+
+// backgroundUi drops the screen updates of an account that is not shown
+type backgroundUi struct {
+	textUi
+}
+
+func (ui *backgroundUi) NewMessage(Message)      {}
+func (ui *backgroundUi) NewScreen([]Message)     {}
+func (ui *backgroundUi) SetChats([]Chat)         {}
+func (ui *backgroundUi) SetStatus(SessionStatus) {}
+
+func TestDeselectedAccountMarksMessagesUnread(t *testing.T) {
+	ui := &backgroundUi{}
+	sm := &SessionManager{}
+	sm.Init(ui)
+	chat := types.NewJID("123", types.DefaultUserServer)
+	sm.execCommand(Command{"select", []string{chat.String()}})
+	sm.execCommand(Command{"select", []string{""}})
+
+	sm.eventHandler.Handle(&events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: chat, Sender: chat},
+			ID:            "msg-1",
+			Timestamp:     time.Unix(100, 0),
+		},
+		Message: &waProto.Message{Conversation: proto.String("hello")},
+	})
+	chats := sm.db.GetChatIds()
+	if len(chats) != 1 || chats[0].Unread != 1 {
+		t.Fatalf("expected the message to be unread, got %#v", chats)
+	}
+}
+
+func TestEventsDoNotBlockWithoutManager(t *testing.T) {
+	sm := &SessionManager{}
+	sm.Init(nil)
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 50; i++ {
+			sm.eventHandler.Handle(&events.Connected{})
+			sm.eventHandler.Handle(&events.Presence{From: types.NewJID("111", types.DefaultUserServer)})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("event handler blocked on a full channel")
+	}
+}
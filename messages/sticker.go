@@ -0,0 +1,77 @@
+package messages
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/normen/whatscli/config"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// width and height of stickers
+const stickerSize = 512
+
+// sendStickerCommand sends an image file as sticker to the current chat
+func (sm *SessionManager) sendStickerCommand(params []string) {
+	if sm.currentReceiver == "" {
+		sm.printCommandUsage("sendsticker", "-> only works in a chat")
+		return
+	}
+	if !checkParam(params, 1) {
+		sm.printCommandUsage("sendsticker", "/path/to/image.png")
+		return
+	}
+	sm.uiHandler.PrintError(sm.sendSticker(sm.currentReceiver, strings.Join(params, " ")))
+}
+
+// sendSticker converts an image to a WebP sticker and sends it
+func (sm *SessionManager) sendSticker(chatID, path string) error {
+	if _, err := types.ParseJID(chatID); err != nil {
+		return fmt.Errorf("invalid JID: %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	baseDir := config.Config.General.PreviewPath
+	if err := os.MkdirAll(baseDir, 0o755); err != nil {
+		return err
+	}
+	stickerPath := filepath.Join(baseDir, fmt.Sprintf("sticker-%d.webp", time.Now().UnixNano()))
+	if err := encodeSticker(path, stickerPath); err != nil {
+		return err
+	}
+	text := mediaDisplayText(MessageKindSticker, "", "", 0)
+	return sm.sendOrQueue(OutboxEntry{ChatId: chatID, Kind: MessageKindSticker, Text: text, Path: stickerPath})
+}
+
+// encodeSticker scales an image to fit 512x512 pixels, pads it with
+// transparency and stores it as WebP
+func encodeSticker(path, stickerPath string) error {
+	filter := fmt.Sprintf("scale=%[1]d:%[1]d:force_original_aspect_ratio=decrease,format=rgba,"+
+		"pad=%[1]d:%[1]d:(ow-iw)/2:(oh-ih)/2:color=0x00000000", stickerSize)
+	out, err := exec.Command("ffmpeg", "-nostdin", "-loglevel", "error", "-y", "-i", path,
+		"-vf", filter, "-frames:v", "1", "-c:v", "libwebp", "-quality", "80", stickerPath).CombinedOutput()
+	if err != nil {
+		return ffmpegError(err, out)
+	}
+	return nil
+}
+
+// stickerPreview converts a WebP sticker to PNG next to it, animated stickers
+// show their first frame
+func stickerPreview(path string) (string, error) {
+	pngPath := strings.TrimSuffix(path, filepath.Ext(path)) + ".png"
+	if _, err := os.Stat(pngPath); err == nil {
+		return pngPath, nil
+	}
+	out, err := exec.Command("ffmpeg", "-nostdin", "-loglevel", "error", "-y", "-i", path,
+		"-frames:v", "1", pngPath).CombinedOutput()
+	if err != nil {
+		return "", ffmpegError(err, out)
+	}
+	return pngPath, nil
+}
@@ -0,0 +1,39 @@
+package messages
+
+import (
+	"testing"
+
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestIncomingSticker(t *testing.T) {
+	sm := &SessionManager{}
+	sm.Init(nil)
+	info := types.MessageInfo{
+		MessageSource: types.MessageSource{Chat: types.NewJID("111", types.DefaultUserServer), Sender: types.NewJID("111", types.DefaultUserServer)},
+		ID:            "m1",
+	}
+	raw := &waProto.Message{StickerMessage: &waProto.StickerMessage{
+		Mimetype: proto.String("image/webp"),
+		Emojis:   proto.String("😀"),
+	}}
+	msg, ok := sm.eventHandler.messageFromInfo(info, raw)
+	if !ok || msg.Kind != MessageKindSticker || msg.Text != "[STICKER] 😀" {
+		t.Fatalf("unexpected message: %#v", msg)
+	}
+	if _, err := downloadableFromMessage(msg); err != nil {
+		t.Fatalf("expected stickers to be downloadable: %v", err)
+	}
+	if downloadFileName(msg) != "m1.webp" {
+		t.Fatalf("unexpected file name: %s", downloadFileName(msg))
+	}
+	if uploadMediaType(MessageKindSticker) != whatsmeow.MediaImage {
+		t.Fatal("expected stickers to be uploaded as images")
+	}
+	if text := messageBodyText(raw); text != "[STICKER] 😀" {
+		t.Fatalf("unexpected quoted text: %q", text)
+	}
+}
@@ -1,6 +1,7 @@
 package messages
 
 import (
+	"database/sql"
 	"fmt"
 	"sort"
 	"strings"
@@ -9,11 +10,22 @@ import (
 )
 
 // MessageDatabase stores messages and contact data.
+// When opened with Open, all changes are also written to a SQLite store.
 type MessageDatabase struct {
 	messages     map[string][]Message
 	messagesById map[string]Message
 	chats        map[string]Chat
 	contacts     map[string]Contact
+	searchIndex  map[string]map[string]struct{}
+	reactions    map[string]map[string]Reaction
+	receipts     map[string]map[string]Receipt
+	pollVotes    map[string]map[string]PollVote
+	outbox       []OutboxEntry
+	groupMembers map[string][]string
+	store        *sql.DB
+
+	// ErrorHandler receives errors from the backing store, if set.
+	ErrorHandler func(error)
 
 	contactLock sync.RWMutex
 	chatLock    sync.RWMutex
@@ -26,6 +38,12 @@ func (md *MessageDatabase) Init() {
 	md.messagesById = make(map[string]Message)
 	md.chats = make(map[string]Chat)
 	md.contacts = make(map[string]Contact)
+	md.searchIndex = make(map[string]map[string]struct{})
+	md.reactions = make(map[string]map[string]Reaction)
+	md.receipts = make(map[string]map[string]Receipt)
+	md.pollVotes = make(map[string]map[string]PollVote)
+	md.outbox = nil
+	md.groupMembers = make(map[string][]string)
 }
 
 // AddMessage stores a message and updates related chat state.
@@ -60,6 +78,8 @@ func (md *MessageDatabase) AddMessage(msg Message, markUnread bool) bool {
 	msg.Unread = markUnread
 	md.messagesById[msg.Id] = msg
 	md.messages[msg.ChatId] = append(md.messages[msg.ChatId], msg)
+	md.indexMessageLocked(msg)
+	md.persistMessage(msg)
 	md.updateChatFromMessageLocked(msg, markUnread)
 	return true
 }
@@ -68,11 +88,14 @@ func (md *MessageDatabase) replaceMessageLocked(msg Message) {
 	msgs := md.messages[msg.ChatId]
 	for idx, current := range msgs {
 		if current.Id == msg.Id {
+			md.unindexMessageLocked(current)
+			md.indexMessageLocked(msg)
 			msgs[idx] = msg
 			md.messages[msg.ChatId] = msgs
-			return
+			break
 		}
 	}
+	md.persistMessage(msg)
 }
 
 func (md *MessageDatabase) updateChatFromMessageLocked(msg Message, markUnread bool) {
@@ -97,15 +120,18 @@ func (md *MessageDatabase) updateChatFromMessageLocked(msg Message, markUnread b
 		chat.Unread++
 	}
 	md.chats[msg.ChatId] = chat
+	md.persistChat(chat)
 
 	if msg.ContactId != "" {
 		md.contactLock.Lock()
 		if _, ok := md.contacts[msg.ContactId]; !ok {
-			md.contacts[msg.ContactId] = Contact{
+			contact := Contact{
 				Id:    msg.ContactId,
 				Name:  msg.ContactName,
 				Short: msg.ContactShort,
 			}
+			md.contacts[msg.ContactId] = contact
+			md.persistContact(contact)
 		}
 		md.contactLock.Unlock()
 	}
@@ -127,8 +153,12 @@ func (md *MessageDatabase) AddChat(chat Chat) {
 		if chat.Unread < existing.Unread {
 			chat.Unread = existing.Unread
 		}
+		if chat == existing {
+			return
+		}
 	}
 	md.chats[chat.Id] = chat
+	md.persistChat(chat)
 }
 
 // UpdateChatUnread syncs unread counts from external sources such as history sync.
@@ -145,12 +175,16 @@ func (md *MessageDatabase) UpdateChatUnread(chatID string, unread int) {
 	msgs := md.messages[chatID]
 	for idx, msg := range msgs {
 		_, ok := unreadSet[msg.Id]
+		changed := msg.Unread != ok
 		msg.Unread = ok
 		msgs[idx] = msg
 		if stored, found := md.messagesById[msg.Id]; found {
 			stored.Unread = ok
 			md.messagesById[msg.Id] = stored
 		}
+		if changed {
+			md.persistMessage(msg)
+		}
 	}
 	md.messages[chatID] = msgs
 
@@ -158,6 +192,7 @@ func (md *MessageDatabase) UpdateChatUnread(chatID string, unread int) {
 	if chat, ok := md.chats[chatID]; ok {
 		chat.Unread = len(ids)
 		md.chats[chatID] = chat
+		md.persistChat(chat)
 	}
 	md.chatLock.Unlock()
 }
@@ -169,7 +204,7 @@ func (md *MessageDatabase) lastIncomingMessageIDsLocked(chatID string, limit int
 	msgs := md.messages[chatID]
 	ids := make([]string, 0, limit)
 	for idx := len(msgs) - 1; idx >= 0 && len(ids) < limit; idx-- {
-		if !msgs[idx].FromMe {
+		if !msgs[idx].FromMe && msgs[idx].Kind != MessageKindSystem {
 			ids = append(ids, msgs[idx].Id)
 		}
 	}
@@ -191,6 +226,7 @@ func (md *MessageDatabase) MarkChatRead(chatID string) []Message {
 			stored := md.messagesById[msg.Id]
 			stored.Unread = false
 			md.messagesById[msg.Id] = stored
+			md.persistMessage(msg)
 		}
 	}
 	md.messages[chatID] = msgs
@@ -199,6 +235,7 @@ func (md *MessageDatabase) MarkChatRead(chatID string) []Message {
 	if chat, ok := md.chats[chatID]; ok {
 		chat.Unread = 0
 		md.chats[chatID] = chat
+		md.persistChat(chat)
 	}
 	md.chatLock.Unlock()
 
@@ -222,6 +259,68 @@ func (md *MessageDatabase) MarkMessageRevoked(messageID string) bool {
 	return true
 }
 
+// ReplaceMessage stores a message, replacing an existing message with the same ID.
+func (md *MessageDatabase) ReplaceMessage(msg Message) {
+	md.messageLock.Lock()
+	existing, ok := md.messagesById[msg.Id]
+	if !ok {
+		md.messageLock.Unlock()
+		md.AddMessage(msg, false)
+		return
+	}
+	defer md.messageLock.Unlock()
+	msg.Unread = existing.Unread
+	md.messagesById[msg.Id] = msg
+	md.replaceMessageLocked(msg)
+	md.updateChatFromMessageLocked(msg, false)
+}
+
+// DeleteMessage removes a message and its reactions.
+func (md *MessageDatabase) DeleteMessage(messageID string) bool {
+	md.messageLock.Lock()
+	defer md.messageLock.Unlock()
+
+	msg, ok := md.messagesById[messageID]
+	if !ok {
+		return false
+	}
+	delete(md.messagesById, messageID)
+	delete(md.reactions, messageID)
+	delete(md.receipts, messageID)
+	delete(md.pollVotes, messageID)
+	msgs := md.messages[msg.ChatId]
+	for idx, current := range msgs {
+		if current.Id == messageID {
+			md.unindexMessageLocked(current)
+			md.messages[msg.ChatId] = append(msgs[:idx], msgs[idx+1:]...)
+			break
+		}
+	}
+	md.deleteMessage(messageID)
+	return true
+}
+
+// EditMessage replaces the text of a message and keeps the previous text in its edit history.
+func (md *MessageDatabase) EditMessage(messageID, text string, timestamp uint64) bool {
+	md.messageLock.Lock()
+	defer md.messageLock.Unlock()
+
+	msg, ok := md.messagesById[messageID]
+	if !ok || text == "" || msg.Text == text || timestamp < msg.EditedAt {
+		return false
+	}
+	since := msg.Timestamp
+	if msg.EditedAt != 0 {
+		since = msg.EditedAt
+	}
+	msg.Edits = append(append([]MessageEdit{}, msg.Edits...), MessageEdit{Text: msg.Text, Timestamp: since})
+	msg.Text = text
+	msg.EditedAt = timestamp
+	md.messagesById[messageID] = msg
+	md.replaceMessageLocked(msg)
+	return true
+}
+
 // AddContact adds or updates a contact in the database.
 func (md *MessageDatabase) AddContact(contact Contact) {
 	md.contactLock.Lock()
@@ -235,17 +334,34 @@ func (md *MessageDatabase) AddContact(contact Contact) {
 		if contact.Short == "" {
 			contact.Short = existing.Short
 		}
+		if contact == existing {
+			return
+		}
 	}
 	md.contacts[contact.Id] = contact
+	md.persistContact(contact)
 }
 
 // GetChatIds returns chats sorted by most recent message first.
 func (md *MessageDatabase) GetChatIds() []Chat {
+	mentioned := make(map[string]bool)
+	md.messageLock.RLock()
+	for chatID, msgs := range md.messages {
+		for _, msg := range msgs {
+			if msg.Unread && msg.MentionsMe {
+				mentioned[chatID] = true
+				break
+			}
+		}
+	}
+	md.messageLock.RUnlock()
+
 	md.chatLock.RLock()
 	defer md.chatLock.RUnlock()
 
 	allChats := make([]Chat, 0, len(md.chats))
 	for _, chat := range md.chats {
+		chat.Mentioned = mentioned[chat.Id]
 		allChats = append(allChats, chat)
 	}
 	sort.Slice(allChats, func(i, j int) bool {
@@ -257,12 +373,68 @@ func (md *MessageDatabase) GetChatIds() []Chat {
 	return allChats
 }
 
+// FindChat resolves a chat id, phone number or chat or contact name to a chat id.
+// Names match case-insensitively, a partial match is accepted if it is unique.
+func (md *MessageDatabase) FindChat(query string) (string, error) {
+	query = strings.TrimSpace(query)
+	if strings.Contains(query, "@") {
+		return query, nil
+	}
+	if number := strings.TrimPrefix(query, "+"); number != "" && strings.Trim(number, "0123456789") == "" {
+		return number + CONTACTSUFFIX, nil
+	}
+
+	lower := strings.ToLower(query)
+	names := make(map[string][]string)
+	for _, chat := range md.GetChatIds() {
+		names[chat.Id] = append(names[chat.Id], chat.Name)
+	}
+	md.contactLock.RLock()
+	for id, contact := range md.contacts {
+		names[id] = append(names[id], contact.Name, contact.Short)
+	}
+	md.contactLock.RUnlock()
+
+	exact := make([]string, 0)
+	partial := make([]string, 0)
+	for id, idNames := range names {
+		for _, name := range idNames {
+			name = strings.ToLower(name)
+			if name == lower {
+				exact = append(exact, id)
+				break
+			} else if name != "" && strings.Contains(name, lower) {
+				partial = append(partial, id)
+				break
+			}
+		}
+	}
+	matches := exact
+	if len(matches) == 0 {
+		matches = partial
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no chat found for %q", query)
+	case 1:
+		return matches[0], nil
+	}
+	sort.Strings(matches)
+	return "", fmt.Errorf("%q matches several chats: %s", query, strings.Join(matches, ", "))
+}
+
 // GetMessages returns all messages for the given chat, sorted by timestamp.
 func (md *MessageDatabase) GetMessages(chatID string) []Message {
 	md.messageLock.RLock()
 	msgs := md.messages[chatID]
 	out := make([]Message, len(msgs))
 	copy(out, msgs)
+	for idx := range out {
+		out[idx].Reactions = md.reactionsLocked(out[idx].Id)
+		out[idx].Receipts = md.receiptsLocked(out[idx].Id)
+		out[idx].Recipients = md.recipientCountLocked(out[idx])
+		out[idx].PollVotes = md.pollVotesLocked(out[idx].Id)
+	}
 	md.messageLock.RUnlock()
 
 	sort.Slice(out, func(i, j int) bool {
@@ -274,11 +446,31 @@ func (md *MessageDatabase) GetMessages(chatID string) []Message {
 	return out
 }
 
+// GetChatSenders returns the ids of everyone except us who sent a message to the given chat.
+func (md *MessageDatabase) GetChatSenders(chatID string) []string {
+	md.messageLock.RLock()
+	defer md.messageLock.RUnlock()
+	seen := make(map[string]bool)
+	out := make([]string, 0)
+	for _, msg := range md.messages[chatID] {
+		if msg.FromMe || msg.Imported || msg.SenderId == "" || seen[msg.SenderId] {
+			continue
+		}
+		seen[msg.SenderId] = true
+		out = append(out, msg.SenderId)
+	}
+	return out
+}
+
 // GetMessage returns a single message by ID.
 func (md *MessageDatabase) GetMessage(id string) (Message, bool) {
 	md.messageLock.RLock()
 	defer md.messageLock.RUnlock()
 	msg, ok := md.messagesById[id]
+	msg.Reactions = md.reactionsLocked(id)
+	msg.Receipts = md.receiptsLocked(id)
+	msg.Recipients = md.recipientCountLocked(msg)
+	msg.PollVotes = md.pollVotesLocked(id)
 	return msg, ok
 }
 
@@ -337,6 +529,30 @@ func (md *MessageDatabase) GetMessageInfo(id string) string {
 	if msg.SenderId != "" {
 		info += "\nSender: " + msg.SenderId
 	}
+	if msg.EditedAt != 0 {
+		info += "\nEdited: " + time.Unix(int64(msg.EditedAt), 0).Format(time.RFC1123)
+	}
+	for _, edit := range msg.Edits {
+		info += "\nPrevious (" + time.Unix(int64(edit.Timestamp), 0).Format(time.RFC1123) + "): " + edit.Text
+	}
+	if msg.Imported {
+		info += "\nImported: read-only message from a chat export"
+	}
+	for _, reaction := range msg.Reactions {
+		info += "\nReaction: " + reaction.Emoji + " " + md.GetIdName(reaction.SenderId)
+	}
+	for _, vote := range msg.PollVotes {
+		info += "\nVote: " + md.GetIdName(vote.VoterId) + ": " + strings.Join(pollVoteNames(msg, vote), ", ")
+	}
+	if msg.FromMe && !msg.Pending {
+		info += "\nStatus: " + msg.ReceiptState().String()
+	}
+	for _, receipt := range msg.Receipts {
+		info += "\n" + receiptLabels[receipt.State] + ": " + md.GetIdName(receipt.ParticipantId)
+		if receipt.Timestamp != 0 {
+			info += " (" + time.Unix(int64(receipt.Timestamp), 0).Format(time.RFC1123) + ")"
+		}
+	}
 	return info
 }
 
@@ -1,6 +1,12 @@
 package messages
 
-import "testing"
+import (
+	"path/filepath"
+	"testing"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"google.golang.org/protobuf/proto"
+)
 
 func TestAddMessageAndMarkChatRead(t *testing.T) {
 	db := &MessageDatabase{}
@@ -93,3 +99,126 @@ func TestUpdateChatUnreadMarksLatestIncomingMessages(t *testing.T) {
 		t.Fatalf("expected 2 unread messages, got %d", unread)
 	}
 }
+
+func TestOpenRestoresPersistedMessages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "messages.db")
+
+	db := &MessageDatabase{}
+	if err := db.Open(path); err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	db.AddMessage(Message{
+		Id:          "msg-1",
+		ChatId:      "123@s.whatsapp.net",
+		ContactId:   "123@s.whatsapp.net",
+		ContactName: "Alice",
+		Timestamp:   100,
+		Text:        "hello",
+		Kind:        MessageKindText,
+		RawMessage:  &waProto.Message{Conversation: proto.String("hello")},
+	}, true)
+	db.AddMessage(Message{
+		Id:        "msg-2",
+		ChatId:    "123@s.whatsapp.net",
+		ContactId: "123@s.whatsapp.net",
+		Timestamp: 101,
+		Text:      "bye",
+		Kind:      MessageKindText,
+	}, true)
+	db.MarkMessageRevoked("msg-2")
+	if err := db.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+
+	db = &MessageDatabase{}
+	if err := db.Open(path); err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer db.Close()
+
+	msgs := db.GetMessages("123@s.whatsapp.net")
+	if len(msgs) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(msgs))
+	}
+	if msgs[0].RawMessage.GetConversation() != "hello" || !msgs[0].Unread {
+		t.Fatalf("unexpected first message: %#v", msgs[0])
+	}
+	if msgs[1].Text != "[message revoked]" {
+		t.Fatalf("expected revoked text, got %q", msgs[1].Text)
+	}
+	chats := db.GetChatIds()
+	if len(chats) != 1 || chats[0].Unread != 2 || chats[0].Name != "Alice" {
+		t.Fatalf("unexpected chats: %#v", chats)
+	}
+	if db.GetIdName("123@s.whatsapp.net") != "Alice" {
+		t.Fatalf("expected contact to be restored")
+	}
+
+	db.MarkChatRead("123@s.whatsapp.net")
+	db.Close()
+	db = &MessageDatabase{}
+	if err := db.Open(path); err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer db.Close()
+	if chats = db.GetChatIds(); chats[0].Unread != 0 {
+		t.Fatalf("expected read state to persist, got %d unread", chats[0].Unread)
+	}
+}
+
+func TestEditMessageKeepsHistory(t *testing.T) {
+	db := &MessageDatabase{}
+	db.Init()
+	db.AddMessage(Message{Id: "msg-1", ChatId: "123@s.whatsapp.net", Timestamp: 100, Text: "helo", Kind: MessageKindText}, false)
+
+	if !db.EditMessage("msg-1", "hello", 110) {
+		t.Fatal("expected edit to be applied")
+	}
+	if db.EditMessage("msg-1", "hello", 120) {
+		t.Fatal("expected unchanged edit to be ignored")
+	}
+	if db.EditMessage("msg-1", "older", 105) {
+		t.Fatal("expected outdated edit to be ignored")
+	}
+	db.EditMessage("msg-1", "hello world", 130)
+
+	msg, _ := db.GetMessage("msg-1")
+	if msg.Text != "hello world" || msg.EditedAt != 130 {
+		t.Fatalf("unexpected edited message: %#v", msg)
+	}
+	if len(msg.Edits) != 2 || msg.Edits[0] != (MessageEdit{Text: "helo", Timestamp: 100}) || msg.Edits[1] != (MessageEdit{Text: "hello", Timestamp: 110}) {
+		t.Fatalf("unexpected edit history: %#v", msg.Edits)
+	}
+	if results := db.SearchMessages("world", 0); len(results) != 1 {
+		t.Fatalf("expected edited text to be indexed, got %#v", results)
+	}
+}
+
+func TestFindChatResolvesNamesAndNumbers(t *testing.T) {
+	db := &MessageDatabase{}
+	db.Init()
+	db.AddChat(Chat{Id: "111@s.whatsapp.net", Name: "Alice Smith"})
+	db.AddChat(Chat{Id: "222@s.whatsapp.net", Name: "Alicia"})
+	db.AddChat(Chat{Id: "team@g.us", IsGroup: true, Name: "Project Team"})
+	db.AddContact(Contact{Id: "333@s.whatsapp.net", Name: "Bob Builder", Short: "Bob"})
+
+	cases := map[string]string{
+		"team@g.us":    "team@g.us",
+		"+49123":       "49123@s.whatsapp.net",
+		"alicia":       "222@s.whatsapp.net",
+		"project":      "team@g.us",
+		"bob":          "333@s.whatsapp.net",
+		"Alice Smith ": "111@s.whatsapp.net",
+	}
+	for query, expected := range cases {
+		if got, err := db.FindChat(query); err != nil || got != expected {
+			t.Fatalf("FindChat(%q) = %q, %v; expected %q", query, got, err, expected)
+		}
+	}
+	if _, err := db.FindChat("ali"); err == nil {
+		t.Fatal("expected ambiguous name to fail")
+	}
+	if _, err := db.FindChat("nobody"); err == nil {
+		t.Fatal("expected unknown name to fail")
+	}
+}
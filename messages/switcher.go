@@ -0,0 +1,123 @@
+package messages
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// FuzzyChats returns the chats and contacts whose name or number contains the
+// letters of query in order, best matches first. Recent chats rank higher,
+// an empty query returns the most recent chats.
+func (md *MessageDatabase) FuzzyChats(query string, limit int) []Chat {
+	candidates := md.GetChatIds()
+	known := make(map[string]bool, len(candidates))
+	for _, chat := range candidates {
+		known[chat.Id] = true
+	}
+	md.contactLock.RLock()
+	for _, contact := range md.contacts {
+		if !known[contact.Id] && strings.HasSuffix(contact.Id, CONTACTSUFFIX) {
+			candidates = append(candidates, Chat{Id: contact.Id, Name: contact.Name})
+		}
+	}
+	md.contactLock.RUnlock()
+
+	now := time.Now().Unix()
+	type ranked struct {
+		chat  Chat
+		score int
+	}
+	matches := make([]ranked, 0, len(candidates))
+	for _, chat := range candidates {
+		if chat.Name == "" {
+			chat.Name = md.GetIdName(chat.Id)
+		}
+		score := fuzzyScore(chat.Name, query)
+		if !chat.IsGroup {
+			number := strings.SplitN(chat.Id, "@", 2)[0]
+			if numberScore := fuzzyScore(number, query); numberScore > score {
+				score = numberScore
+			}
+		}
+		if score < 0 {
+			continue
+		}
+		matches = append(matches, ranked{chat, score + recencyScore(chat.LastMessage, now)})
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		if matches[i].chat.LastMessage != matches[j].chat.LastMessage {
+			return matches[i].chat.LastMessage > matches[j].chat.LastMessage
+		}
+		return strings.ToLower(matches[i].chat.Name) < strings.ToLower(matches[j].chat.Name)
+	})
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	out := make([]Chat, len(matches))
+	for idx, match := range matches {
+		out[idx] = match.chat
+	}
+	return out
+}
+
+// fuzzyScore rates how well text matches query, it is -1 if the letters of
+// query do not appear in text in order. Consecutive letters, letters at the
+// start of words and prefixes score higher.
+func fuzzyScore(text, query string) int {
+	lowerText := strings.ToLower(text)
+	lowerQuery := strings.ToLower(strings.TrimSpace(query))
+	if lowerQuery == "" {
+		return 0
+	}
+	runes := []rune(lowerText)
+	score, pos, last := 0, 0, -2
+	for _, letter := range lowerQuery {
+		found := false
+		for ; pos < len(runes); pos++ {
+			if runes[pos] != letter {
+				continue
+			}
+			score++
+			if pos == last+1 {
+				score += 5
+			}
+			if pos == 0 || !unicode.IsLetter(runes[pos-1]) && !unicode.IsNumber(runes[pos-1]) {
+				score += 8
+			}
+			last = pos
+			pos++
+			found = true
+			break
+		}
+		if !found {
+			return -1
+		}
+	}
+	if lowerText == lowerQuery {
+		score += 50
+	} else if strings.HasPrefix(lowerText, lowerQuery) {
+		score += 20
+	}
+	return score
+}
+
+// recencyScore prefers chats with recent messages
+func recencyScore(lastMessage, now int64) int {
+	age := now - lastMessage
+	switch {
+	case lastMessage == 0:
+		return 0
+	case age < 24*60*60:
+		return 10
+	case age < 7*24*60*60:
+		return 6
+	case age < 30*24*60*60:
+		return 3
+	}
+	return 1
+}
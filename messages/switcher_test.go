@@ -0,0 +1,49 @@
+package messages
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFuzzyScore(t *testing.T) {
+	if fuzzyScore("Alice", "xyz") != -1 {
+		t.Fatal("expected no match")
+	}
+	if fuzzyScore("Alice", "") != 0 {
+		t.Fatal("expected empty query to match everything")
+	}
+	if fuzzyScore("Alice Cooper", "ali") <= fuzzyScore("Marlin", "ali") {
+		t.Fatal("expected prefix to beat a match inside a word")
+	}
+	if fuzzyScore("Bob Cooper", "bc") <= fuzzyScore("Bacon", "bc") {
+		t.Fatal("expected word starts to beat scattered letters")
+	}
+	if fuzzyScore("Bob", "bob") <= fuzzyScore("Bobby", "bob") {
+		t.Fatal("expected exact match to beat a prefix")
+	}
+}
+
+func TestFuzzyChats(t *testing.T) {
+	db := &MessageDatabase{}
+	db.Init()
+	now := uint64(time.Now().Unix())
+	db.AddContact(Contact{Id: "111@s.whatsapp.net", Name: "Anna Old", Short: "Anna"})
+	db.AddContact(Contact{Id: "222@s.whatsapp.net", Name: "Anna New", Short: "Anna"})
+	db.AddContact(Contact{Id: "333@s.whatsapp.net", Name: "Without Chat", Short: "Without"})
+	db.AddMessage(Message{Id: "1", ChatId: "111@s.whatsapp.net", Timestamp: now - 60*24*60*60, Text: "old"}, false)
+	db.AddMessage(Message{Id: "2", ChatId: "222@s.whatsapp.net", Timestamp: now, Text: "new"}, true)
+
+	chats := db.FuzzyChats("anna", 10)
+	if len(chats) != 2 || chats[0].Id != "222@s.whatsapp.net" || chats[0].Unread != 1 {
+		t.Fatalf("expected recent chat first: %#v", chats)
+	}
+	if chats = db.FuzzyChats("wit", 10); len(chats) != 1 || chats[0].Id != "333@s.whatsapp.net" {
+		t.Fatalf("expected contact without chat: %#v", chats)
+	}
+	if chats = db.FuzzyChats("333", 10); len(chats) != 1 || chats[0].Name != "Without Chat" {
+		t.Fatalf("expected match by number: %#v", chats)
+	}
+	if chats = db.FuzzyChats("", 1); len(chats) != 1 {
+		t.Fatalf("expected limit to apply: %#v", chats)
+	}
+}
@@ -0,0 +1,291 @@
+package messages
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/normen/whatscli/config"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// the mime type of voice notes, as sent by the phone app
+const voiceMimeType = "audio/ogg; codecs=opus"
+
+// number of loudness values in the waveform of a voice note
+const waveformLength = 64
+
+// sample rate used to measure the duration and loudness of audio
+const measureRate = 8000
+
+// a voice note being recorded by the record command
+type voiceRecording struct {
+	cmd    *exec.Cmd
+	path   string
+	chatID string
+	done   chan error
+}
+
+// voiceCommand starts recording a voice note, sends it when called again or
+// sends an existing audio file as voice note
+func (sm *SessionManager) voiceCommand(params []string) {
+	switch {
+	case checkParam(params, 1) && params[0] == "cancel" && len(params) == 1:
+		if sm.recording == nil {
+			sm.uiHandler.PrintText("No voice note is being recorded")
+			return
+		}
+		path := sm.recording.path
+		sm.stopRecording()
+		os.Remove(path)
+		sm.uiHandler.PrintText("Voice note discarded")
+	case sm.recording != nil && checkParam(params, 1):
+		sm.printCommandUsage("voice", "[cancel[] -> sends or discards the voice note being recorded")
+	case sm.recording != nil:
+		recording := sm.recording
+		err := sm.stopRecording()
+		if err == nil {
+			err = sm.sendVoice(recording.chatID, recording.path)
+		}
+		os.Remove(recording.path)
+		sm.uiHandler.PrintError(err)
+	case sm.currentReceiver == "":
+		sm.printCommandUsage("voice", "-> only works in a chat")
+	case checkParam(params, 1):
+		sm.uiHandler.PrintError(sm.sendVoice(sm.currentReceiver, strings.Join(params, " ")))
+	default:
+		sm.uiHandler.PrintError(sm.startRecording(sm.currentReceiver))
+	}
+}
+
+// startRecording runs the record command with the file to record to appended
+func (sm *SessionManager) startRecording(chatID string) error {
+	parts := strings.Fields(config.Config.General.RecordCommand)
+	if len(parts) == 0 {
+		return errors.New("no record_command configured")
+	}
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("whatscli-voice-%d.wav", time.Now().UnixNano()))
+	cmd := exec.Command(parts[0], append(parts[1:], path)...)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start recording: %v", err)
+	}
+	recording := &voiceRecording{cmd: cmd, path: path, chatID: chatID, done: make(chan error, 1)}
+	go func() {
+		recording.done <- cmd.Wait()
+	}()
+	sm.recording = recording
+	cmdPrefix := config.Config.General.CmdPrefix
+	sm.uiHandler.PrintText("Recording voice note, [::b]" + cmdPrefix + "voice[::-] sends it, [::b]" + cmdPrefix + "voice cancel[::-] discards it")
+	return nil
+}
+
+// stopRecording ends the record command, recorders finish their file when
+// interrupted
+func (sm *SessionManager) stopRecording() error {
+	recording := sm.recording
+	sm.recording = nil
+	if recording == nil {
+		return nil
+	}
+	err := recording.cmd.Process.Signal(os.Interrupt)
+	exited := errors.Is(err, os.ErrProcessDone)
+	if err != nil && !exited {
+		recording.cmd.Process.Kill()
+	}
+	select {
+	case err = <-recording.done:
+		if exited && err != nil {
+			return fmt.Errorf("recording failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		recording.cmd.Process.Kill()
+		<-recording.done
+	}
+	if info, err := os.Stat(recording.path); err != nil || info.Size() == 0 {
+		return errors.New("nothing was recorded")
+	}
+	return nil
+}
+
+// stopVoice discards a running recording and stops the playback
+func (sm *SessionManager) stopVoice() {
+	if sm.recording != nil {
+		path := sm.recording.path
+		sm.stopRecording()
+		os.Remove(path)
+	}
+	sm.stopPlayer()
+}
+
+// sendVoice transcodes an audio file to Opus and sends it as voice note
+func (sm *SessionManager) sendVoice(chatID, path string) error {
+	if _, err := types.ParseJID(chatID); err != nil {
+		return fmt.Errorf("invalid JID: %v", err)
+	}
+	seconds, waveform, err := measureAudio(path)
+	if err != nil {
+		return err
+	}
+	baseDir := config.Config.General.PreviewPath
+	if err = os.MkdirAll(baseDir, 0o755); err != nil {
+		return err
+	}
+	voicePath := filepath.Join(baseDir, fmt.Sprintf("voice-%d.ogg", time.Now().UnixNano()))
+	if err = encodeVoice(path, voicePath); err != nil {
+		return err
+	}
+	text := mediaDisplayText(MessageKindVoice, "", "", seconds)
+	return sm.sendOrQueue(OutboxEntry{
+		ChatId:   chatID,
+		Kind:     MessageKindVoice,
+		Text:     text,
+		Path:     voicePath,
+		Seconds:  seconds,
+		Waveform: waveform,
+	})
+}
+
+// removeVoiceFile deletes the file sendVoice transcoded for a voice note once
+// the outbox does not need it anymore, other files belong to the user
+func removeVoiceFile(entry OutboxEntry) {
+	if entry.Kind == MessageKindVoice && entry.Path != "" {
+		os.Remove(entry.Path)
+	}
+}
+
+// measureAudio decodes an audio file with ffmpeg and returns its duration
+// and waveform
+func measureAudio(path string) (uint32, []byte, error) {
+	out, err := exec.Command("ffmpeg", "-nostdin", "-loglevel", "error", "-i", path,
+		"-f", "s16le", "-ac", "1", "-ar", strconv.Itoa(measureRate), "-").Output()
+	if err != nil {
+		return 0, nil, ffmpegError(err, nil)
+	}
+	samples := make([]int16, len(out)/2)
+	for idx := range samples {
+		samples[idx] = int16(binary.LittleEndian.Uint16(out[2*idx:]))
+	}
+	if len(samples) == 0 {
+		return 0, nil, errors.New("nothing was recorded")
+	}
+	seconds := uint32((len(samples) + measureRate - 1) / measureRate)
+	return seconds, voiceWaveform(samples), nil
+}
+
+// encodeVoice transcodes an audio file to Opus in an OGG container, the
+// format of voice notes
+func encodeVoice(path, voicePath string) error {
+	out, err := exec.Command("ffmpeg", "-nostdin", "-loglevel", "error", "-y", "-i", path,
+		"-vn", "-ac", "1", "-ar", "48000", "-c:a", "libopus", "-b:a", "32k", "-application", "voip", voicePath).CombinedOutput()
+	if err != nil {
+		return ffmpegError(err, out)
+	}
+	return nil
+}
+
+// ffmpegError returns the error output of ffmpeg as error
+func ffmpegError(err error, output []byte) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && output == nil {
+		output = exitErr.Stderr
+	}
+	if errors.Is(err, exec.ErrNotFound) {
+		return fmt.Errorf("voice notes and stickers need ffmpeg: %v", err)
+	}
+	if text := strings.TrimSpace(string(output)); text != "" {
+		return fmt.Errorf("ffmpeg failed: %s", text)
+	}
+	return fmt.Errorf("ffmpeg failed: %v", err)
+}
+
+// voiceWaveform returns the loudness of the samples in 64 slices, scaled from
+// 0 to 100 with the loudest slice at 100
+func voiceWaveform(samples []int16) []byte {
+	waveform := make([]byte, waveformLength)
+	levels := make([]float64, waveformLength)
+	loudest := 0.0
+	for idx := range levels {
+		start := idx * len(samples) / waveformLength
+		end := (idx + 1) * len(samples) / waveformLength
+		if end <= start {
+			continue
+		}
+		sum := 0.0
+		for _, sample := range samples[start:end] {
+			sum += float64(sample) * float64(sample)
+		}
+		levels[idx] = math.Sqrt(sum / float64(end-start))
+		loudest = math.Max(loudest, levels[idx])
+	}
+	if loudest == 0 {
+		return waveform
+	}
+	for idx, level := range levels {
+		waveform[idx] = byte(math.Round(level / loudest * 100))
+	}
+	return waveform
+}
+
+// playCommand plays a voice note or audio message with the play command,
+// without message id it stops the playback
+func (sm *SessionManager) playCommand(params []string) {
+	if !checkParam(params, 1) {
+		if sm.player != nil {
+			sm.stopPlayer()
+			return
+		}
+		sm.printCommandUsage("play", "[message-id[]")
+		return
+	}
+	msg, ok := sm.db.GetMessage(params[0])
+	if !ok {
+		sm.uiHandler.PrintError(errors.New("message not found"))
+		return
+	}
+	if msg.Kind != MessageKindVoice && msg.Kind != MessageKindAudio {
+		sm.uiHandler.PrintError(errors.New("play only works for voice and audio messages"))
+		return
+	}
+	path, err := sm.downloadMessage(msg, true)
+	if err != nil {
+		sm.uiHandler.PrintError(err)
+		return
+	}
+	sm.uiHandler.PrintError(sm.playFile(path))
+}
+
+// playFile runs the play command in the background, a previous playback is
+// stopped
+func (sm *SessionManager) playFile(path string) error {
+	sm.stopPlayer()
+	parts := strings.Fields(config.Config.General.PlayCommand)
+	if len(parts) == 0 {
+		return errors.New("no play_command configured")
+	}
+	cmd := exec.Command(parts[0], append(parts[1:], path)...)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start player: %v", err)
+	}
+	sm.player = cmd
+	go cmd.Wait()
+	return nil
+}
+
+func (sm *SessionManager) stopPlayer() {
+	if sm.player != nil {
+		sm.player.Process.Kill()
+		sm.player = nil
+	}
+}
+
+// formatDuration shows a duration in seconds as minutes:seconds
+func formatDuration(seconds uint32) string {
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
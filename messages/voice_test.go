@@ -0,0 +1,127 @@
+package messages
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestVoiceWaveform(t *testing.T) {
+	samples := make([]int16, 640)
+	for idx := range samples {
+		if idx >= 320 {
+			samples[idx] = 1000
+		} else if idx%2 == 0 {
+			samples[idx] = 500
+		} else {
+			samples[idx] = -500
+		}
+	}
+	waveform := voiceWaveform(samples)
+	if len(waveform) != waveformLength {
+		t.Fatalf("expected %d values, got %d", waveformLength, len(waveform))
+	}
+	if waveform[0] != 50 || waveform[63] != 100 {
+		t.Fatalf("unexpected waveform: %v", waveform)
+	}
+	for _, level := range voiceWaveform(make([]int16, 10)) {
+		if level != 0 {
+			t.Fatal("expected silence to stay flat")
+		}
+	}
+	if len(voiceWaveform([]int16{100})) != waveformLength {
+		t.Fatal("expected full waveform for short audio")
+	}
+}
+
+func TestVoiceDisplayText(t *testing.T) {
+	if text := mediaDisplayText(MessageKindVoice, "", "", 75); text != "[VOICE] 1:15" {
+		t.Fatalf("unexpected text: %q", text)
+	}
+	if text := mediaDisplayText(MessageKindAudio, "", "", 0); text != "[AUDIO]" {
+		t.Fatalf("unexpected text: %q", text)
+	}
+
+	sm := &SessionManager{}
+	sm.Init(nil)
+	info := types.MessageInfo{
+		MessageSource: types.MessageSource{Chat: types.NewJID("111", types.DefaultUserServer), Sender: types.NewJID("111", types.DefaultUserServer)},
+		ID:            "m1",
+	}
+	raw := &waProto.Message{AudioMessage: &waProto.AudioMessage{
+		Mimetype: proto.String(voiceMimeType),
+		Seconds:  proto.Uint32(9),
+		PTT:      proto.Bool(true),
+	}}
+	msg, ok := sm.eventHandler.messageFromInfo(info, raw)
+	if !ok || msg.Kind != MessageKindVoice || msg.Text != "[VOICE] 0:09" {
+		t.Fatalf("unexpected message: %#v", msg)
+	}
+	if _, err := downloadableFromMessage(msg); err != nil {
+		t.Fatalf("expected voice notes to be downloadable: %v", err)
+	}
+	if kind := importedAttachmentKind("PTT-20261017-WA0001.opus"); kind != MessageKindVoice {
+		t.Fatalf("unexpected kind: %s", kind)
+	}
+}
+
+// textUi records the text and errors the session manager prints
+type textUi struct {
+	errorUi
+	texts []string
+}
+
+func (ui *textUi) PrintText(text string) {
+	ui.texts = append(ui.texts, text)
+}
+
+func TestVoiceWhileRecordingRejectsFile(t *testing.T) {
+	ui := &textUi{}
+	sm := &SessionManager{}
+	sm.Init(ui)
+	sm.currentReceiver = "111@s.whatsapp.net"
+	recording := &voiceRecording{path: "recording.wav", chatID: sm.currentReceiver}
+	sm.recording = recording
+	sm.voiceCommand([]string{"note.wav"})
+	if sm.recording != recording {
+		t.Fatal("expected the recording to continue")
+	}
+	if len(ui.texts) != 1 || !strings.Contains(ui.texts[0], "Usage:") || len(ui.errors) != 0 {
+		t.Fatalf("expected usage, got %q %v", ui.texts, ui.errors)
+	}
+}
+
+func TestCancelledVoiceNoteIsDeleted(t *testing.T) {
+	dir := t.TempDir()
+	ui := &textUi{}
+	sm := &SessionManager{}
+	sm.Init(ui)
+	if err := sm.db.Open(filepath.Join(dir, "messages.db")); err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	defer sm.db.Close()
+	voicePath := filepath.Join(dir, "voice-1.ogg")
+	imagePath := filepath.Join(dir, "image.jpg")
+	for _, path := range []string{voicePath, imagePath} {
+		if err := os.WriteFile(path, []byte("data"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sm.db.AddOutboxEntry(OutboxEntry{Id: "out-1", ChatId: "111@s.whatsapp.net", Kind: MessageKindVoice, Path: voicePath})
+	sm.db.AddOutboxEntry(OutboxEntry{Id: "out-2", ChatId: "111@s.whatsapp.net", Kind: MessageKindImage, Path: imagePath})
+	sm.outboxCommand([]string{"cancel", "out-1", "out-2"})
+	if len(sm.db.GetOutbox()) != 0 || len(ui.errors) != 0 {
+		t.Fatalf("expected empty outbox, got %#v %v", sm.db.GetOutbox(), ui.errors)
+	}
+	if _, err := os.Stat(voicePath); !os.IsNotExist(err) {
+		t.Fatalf("expected transcoded voice note to be deleted: %v", err)
+	}
+	if _, err := os.Stat(imagePath); err != nil {
+		t.Fatalf("expected the file of the user to be kept: %v", err)
+	}
+}
@@ -0,0 +1,200 @@
+package messages
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/normen/whatscli/config"
+	"github.com/rivo/tview"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// whoisCommand shows details about a contact or group, the current chat by default
+func (sm *SessionManager) whoisCommand(params []string) {
+	chatID := sm.currentReceiver
+	if len(params) > 0 {
+		var err error
+		if chatID, err = sm.db.FindChat(strings.Join(params, " ")); err != nil {
+			sm.uiHandler.PrintError(err)
+			return
+		}
+	}
+	if chatID == "" {
+		sm.printCommandUsage("whois", "[chat-id|number|name[] -> or select a chat")
+		return
+	}
+	if sm.client == nil || !sm.client.IsConnected() {
+		sm.uiHandler.PrintError(errors.New("not connected to WhatsApp"))
+		return
+	}
+	jid, err := types.ParseJID(chatID)
+	if err != nil {
+		sm.uiHandler.PrintError(fmt.Errorf("invalid JID: %v", err))
+		return
+	}
+	if jid.Server == types.GroupServer {
+		info, err := sm.client.GetGroupInfo(context.Background(), jid)
+		if err != nil {
+			sm.uiHandler.PrintError(err)
+			return
+		}
+		sm.db.SetGroupMembers(chatID, participantStrings(info.Participants))
+		sm.uiHandler.PrintText(formatGroupInfo(info, sm.whoisName))
+	} else {
+		sm.uiHandler.PrintText(sm.contactInfo(jid))
+	}
+	if path, err := sm.downloadProfilePicture(jid); err != nil {
+		sm.uiHandler.PrintError(err)
+	} else if path != "" {
+		sm.uiHandler.PrintFile(path)
+	}
+}
+
+// contactInfo collects the names, about text and common groups of a contact
+func (sm *SessionManager) contactInfo(jid types.JID) string {
+	ctx := context.Background()
+	info := "[::b]" + tview.Escape(sm.whoisName(jid)) + "[::-]\nID: " + jid.String()
+	if contact, err := sm.client.Store.Contacts.GetContact(ctx, jid); err == nil && contact.Found {
+		if contact.PushName != "" {
+			info += "\nPush name: " + tview.Escape(contact.PushName)
+		}
+		if contact.FullName != "" {
+			info += "\nFull name: " + tview.Escape(contact.FullName)
+		}
+		if contact.BusinessName != "" {
+			info += "\nBusiness name: " + tview.Escape(contact.BusinessName)
+		}
+	}
+	if users, err := sm.client.GetUserInfo(ctx, []types.JID{jid}); err == nil {
+		if user, ok := users[jid]; ok {
+			if user.VerifiedName != nil && user.VerifiedName.Details.GetVerifiedName() != "" {
+				info += "\nVerified name: " + tview.Escape(user.VerifiedName.Details.GetVerifiedName())
+			}
+			if user.Status != "" {
+				info += "\nAbout: " + tview.Escape(user.Status)
+			}
+		}
+	}
+	if groups, err := sm.client.GetJoinedGroups(ctx); err == nil {
+		common := commonGroups(groups, jid)
+		if len(common) > 0 {
+			info += "\nCommon groups: " + tview.Escape(strings.Join(common, ", "))
+		}
+	}
+	return info
+}
+
+// commonGroups returns the names of the groups a user is a member of
+func commonGroups(groups []*types.GroupInfo, jid types.JID) []string {
+	user := jid.ToNonAD()
+	names := make([]string, 0)
+	for _, group := range groups {
+		for _, participant := range group.Participants {
+			if participant.JID.ToNonAD() == user || participant.PhoneNumber.ToNonAD() == user || participant.LID.ToNonAD() == user {
+				names = append(names, group.Name)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// formatGroupInfo shows the description, settings and members of a group,
+// admins first
+func formatGroupInfo(info *types.GroupInfo, nameOf func(types.JID) string) string {
+	out := "[::b]" + tview.Escape(info.Name) + "[::-]\nID: " + info.JID.String()
+	if info.Topic != "" {
+		out += "\nDescription: " + tview.Escape(info.Topic)
+	}
+	if !info.GroupCreated.IsZero() {
+		out += "\nCreated: " + info.GroupCreated.Format(time.RFC1123)
+	}
+	if !info.OwnerJID.IsEmpty() {
+		out += "\nOwner: " + tview.Escape(nameOf(info.OwnerJID))
+	}
+	out += "\nSend messages: " + yesNo(info.IsAnnounce, "only admins", "all members")
+	out += "\nEdit group info: " + yesNo(info.IsLocked, "only admins", "all members")
+	out += "\nAdd members: " + yesNo(info.MemberAddMode == types.GroupMemberAddModeAdmin, "only admins", "all members")
+	out += "\nJoin approval: " + yesNo(info.IsJoinApprovalRequired, "required", "not required")
+	if info.IsEphemeral {
+		out += "\nDisappearing messages: " + (time.Duration(info.DisappearingTimer) * time.Second).String()
+	} else {
+		out += "\nDisappearing messages: off"
+	}
+
+	participants := append([]types.GroupParticipant{}, info.Participants...)
+	sort.SliceStable(participants, func(i, j int) bool {
+		if participants[i].IsAdmin != participants[j].IsAdmin {
+			return participants[i].IsAdmin
+		}
+		return strings.ToLower(nameOf(participants[i].JID)) < strings.ToLower(nameOf(participants[j].JID))
+	})
+	out += fmt.Sprintf("\nParticipants (%d):", len(participants))
+	for _, participant := range participants {
+		out += "\n  " + tview.Escape(nameOf(participant.JID)) + " (" + participant.JID.User + ")"
+		if participant.IsSuperAdmin {
+			out += " [::b]owner[::-]"
+		} else if participant.IsAdmin {
+			out += " [::b]admin[::-]"
+		}
+	}
+	return out
+}
+
+func yesNo(value bool, yes, no string) string {
+	if value {
+		return yes
+	}
+	return no
+}
+
+// whoisName returns the best known name of a user
+func (sm *SessionManager) whoisName(jid types.JID) string {
+	return sm.eventHandler.getContactName(jid.ToNonAD())
+}
+
+// the download of profile pictures runs on the session manager goroutine,
+// a stalled connection must not block it for long
+var profilePictureClient = &http.Client{Timeout: 15 * time.Second}
+
+// downloadProfilePicture stores the profile picture of a contact or group in
+// the preview folder, it returns an empty path if there is none
+func (sm *SessionManager) downloadProfilePicture(jid types.JID) (string, error) {
+	picture, err := sm.client.GetProfilePictureInfo(context.Background(), jid, &whatsmeow.GetProfilePictureParams{})
+	if errors.Is(err, whatsmeow.ErrProfilePictureNotSet) || errors.Is(err, whatsmeow.ErrProfilePictureUnauthorized) || picture == nil && err == nil {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	baseDir := config.Config.General.PreviewPath
+	if err = os.MkdirAll(baseDir, 0o755); err != nil {
+		return "", err
+	}
+	fullPath := filepath.Join(baseDir, "profile-"+safeFileName(jid.User)+"-"+safeFileName(picture.ID)+".jpg")
+	if _, err = os.Stat(fullPath); err == nil {
+		return fullPath, nil
+	}
+	resp, err := profilePictureClient.Get(picture.URL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download profile picture: %s", resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return fullPath, os.WriteFile(fullPath, data, 0o644)
+}
@@ -0,0 +1,55 @@
+package messages
+
+import (
+	"strings"
+	"testing"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+func TestFormatGroupInfo(t *testing.T) {
+	alice := types.NewJID("111", types.DefaultUserServer)
+	bob := types.NewJID("222", types.DefaultUserServer)
+	carol := types.NewJID("333", types.DefaultUserServer)
+	info := &types.GroupInfo{
+		JID:            types.NewJID("444", types.GroupServer),
+		OwnerJID:       alice,
+		GroupName:      types.GroupName{Name: "Climbing [club]"},
+		GroupTopic:     types.GroupTopic{Topic: "Weekly sessions"},
+		GroupAnnounce:  types.GroupAnnounce{IsAnnounce: true},
+		GroupEphemeral: types.GroupEphemeral{IsEphemeral: true, DisappearingTimer: 86400},
+		Participants: []types.GroupParticipant{
+			{JID: carol},
+			{JID: bob, IsAdmin: true},
+			{JID: alice, IsAdmin: true, IsSuperAdmin: true},
+		},
+	}
+	names := map[types.JID]string{alice: "Alice", bob: "Bob", carol: "Carol"}
+	out := formatGroupInfo(info, func(jid types.JID) string { return names[jid] })
+
+	for _, expected := range []string{
+		"[::b]Climbing [club[][::-]",
+		"Description: Weekly sessions",
+		"Owner: Alice",
+		"Send messages: only admins",
+		"Edit group info: all members",
+		"Disappearing messages: 24h0m0s",
+		"Participants (3):\n  Alice (111) [::b]owner[::-]\n  Bob (222) [::b]admin[::-]\n  Carol (333)",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Fatalf("expected %q in:\n%s", expected, out)
+		}
+	}
+}
+
+func TestCommonGroups(t *testing.T) {
+	alice := types.NewJID("111", types.DefaultUserServer)
+	groups := []*types.GroupInfo{
+		{GroupName: types.GroupName{Name: "Work"}, Participants: []types.GroupParticipant{{JID: alice}}},
+		{GroupName: types.GroupName{Name: "Other"}, Participants: []types.GroupParticipant{{JID: types.NewJID("222", types.DefaultUserServer)}}},
+		{GroupName: types.GroupName{Name: "Family"}, Participants: []types.GroupParticipant{{JID: types.NewJID("9", types.HiddenUserServer), PhoneNumber: alice}}},
+	}
+	if common := commonGroups(groups, alice); strings.Join(common, ",") != "Family,Work" {
+		t.Fatalf("unexpected common groups: %v", common)
+	}
+}